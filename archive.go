@@ -0,0 +1,122 @@
+package twt
+
+import (
+	"bytes"
+	"errors"
+	"github.com/m25n/twt/twtxt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"time"
+)
+
+var ArchiveNotFoundErr = errors.New("archive not found")
+
+var archiveNameRegex = regexp.MustCompile(`^twtxt-[a-z2-7]{7}\.txt$`)
+
+func archiveName(hash string) string {
+	return "twtxt-" + hash + ".txt"
+}
+
+type ArchivePolicy struct {
+	// MaxSize archives twts once twtxt.txt grows beyond this many bytes. Zero
+	// disables the size threshold.
+	MaxSize int64
+	// MaxAge archives twts older than this. Zero disables the age threshold.
+	MaxAge time.Duration
+	// Keep is the number of newest twts that are never archived. Negative
+	// values count as zero.
+	Keep int
+	// Force archives every twt but the newest Keep regardless of size and age.
+	Force bool
+}
+
+func (p ArchivePolicy) selectTwts(feed *twtxt.Feed, now time.Time) []bool {
+	selected := make([]bool, len(feed.Twts))
+	order := make([]int, len(feed.Twts))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return feed.Twts[order[i]].Created.Before(feed.Twts[order[j]].Created)
+	})
+	candidates := len(order)
+	if p.Keep > 0 {
+		candidates -= p.Keep
+	}
+	if candidates <= 0 {
+		return selected
+	}
+	oversized := false
+	if p.MaxSize > 0 {
+		size, _ := feed.WriteTo(io.Discard)
+		oversized = size > p.MaxSize
+	}
+	for _, i := range order[:candidates] {
+		expired := p.MaxAge > 0 && now.Sub(feed.Twts[i].Created) > p.MaxAge
+		selected[i] = p.Force || oversized || expired
+	}
+	return selected
+}
+
+// splitArchive moves the selected twts into an archive that keeps the feed's
+// metadata, so archives chain through "# prev =".
+func splitArchive(feed *twtxt.Feed, selected []bool) *twtxt.Feed {
+	archive := &twtxt.Feed{}
+	for _, c := range feed.Comments {
+		if _, _, ok := c.Metadata(); ok {
+			archive.Comments = append(archive.Comments, c)
+		}
+	}
+	remaining := make([]twtxt.Twt, 0, len(feed.Twts))
+	for i, t := range feed.Twts {
+		if selected[i] {
+			archive.Twts = append(archive.Twts, t)
+		} else {
+			remaining = append(remaining, t)
+		}
+	}
+	feed.Twts = remaining
+	return archive
+}
+
+func newestTwt(twts []twtxt.Twt) twtxt.Twt {
+	newest := twts[0]
+	for _, t := range twts[1:] {
+		if t.Created.After(newest.Created) {
+			newest = t
+		}
+	}
+	return newest
+}
+
+func getArchiveHandler(logger Logger, db DB) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		file, err := db.GetArchive(req.URL.Path[1:])
+		if errors.Is(err, ArchiveNotFoundErr) {
+			http.NotFound(res, req)
+			return
+		}
+		if err != nil {
+			logger.GettingTwtxtErr(err)
+			res.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		defer file.Close()
+		res.Header().Set("Content-Type", "text/vnd.twtxt+plain")
+		if _, err := io.Copy(res, file); err != nil {
+			logger.WritingBodyErr(err)
+		}
+	}
+}
+
+func isArchivePath(path string) bool {
+	return len(path) > 1 && archiveNameRegex.MatchString(path[1:])
+}
+
+func writeFeed(feed *twtxt.Feed) []byte {
+	buf := bytes.NewBuffer(nil)
+	_, _ = feed.WriteTo(buf)
+	return buf.Bytes()
+}
@@ -12,6 +12,7 @@ func BasicAuth(validUsername string, validPassword string) Middleware {
 			if verify(validUsername, username, validPassword, password) {
 				next(res, req)
 			} else {
+				res.Header().Set("WWW-Authenticate", `Basic realm="twtd", charset="UTF-8"`)
 				http.Error(res, "Unauthorized", http.StatusUnauthorized)
 			}
 		}
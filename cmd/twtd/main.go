@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
 	"github.com/m25n/twt"
 	"github.com/m25n/twt/logger"
 	"github.com/m25n/twt/task"
@@ -10,7 +11,9 @@ import (
 	"math"
 	"net/http"
 	"os"
+	"path/filepath"
 	"runtime"
+	"time"
 )
 
 var (
@@ -22,10 +25,34 @@ func main() {
 	l := log.Default()
 
 	l.Printf("running twtd/%s (%s)", version, gitCommit)
+	if len(os.Args) > 1 && os.Args[1] == "archive" {
+		archive(l, os.Args[2:])
+		return
+	}
+
 	addr := flag.String("http", ":8080", "address and port to bind to")
 	basedir := flag.String("dir", ".", "directory where the twtxt.txt file is located")
+	feedURL := flag.String("url", "", "public URL of twtxt.txt, used when it has no url metadata")
+	archiveSize := flag.Int64("archive-size", 0, "archive twts once twtxt.txt grows beyond this many bytes (0 disables)")
+	archiveAge := flag.Duration("archive-age", 0, "archive twts older than this (0 disables)")
+	archiveKeep := flag.Int("archive-keep", 20, "number of newest twts that are never archived")
+	archiveInterval := flag.Duration("archive-interval", time.Hour, "how often to check the archive thresholds")
+	verifyInterval := flag.Duration("verify-interval", 0, "how often to verify followers by fetching their feeds, requires -url (0 disables)")
+	listInterval := flag.Duration("list-interval", 6*time.Hour, "how often to fetch the follower lists of pods following us (0 disables)")
+	timelineInterval := flag.Duration("timeline-interval", 15*time.Minute, "how often to fetch the feeds we follow (0 disables)")
+	mentionsInterval := flag.Duration("mentions-interval", 0, "how often to fetch the feeds of verified and recently seen followers for mentions (0 disables)")
+	allowPrivate := flag.Bool("allow-private", false, "allow fetching URLs on loopback, private and link-local addresses")
+	hub := flag.String("hub", "", "WebSub hub to ping after new statuses, by default twtd is its own hub")
+	authorizationEndpoint := flag.String("authorization-endpoint", "", "IndieAuth authorization endpoint Micropub clients sign in with, e.g. https://indieauth.com/auth")
+	tokenEndpoint := flag.String("token-endpoint", "", "IndieAuth token endpoint that issues and verifies Micropub access tokens, e.g. https://tokens.indieauth.com/token")
 	flag.Parse()
 
+	if *tokenEndpoint != "" && *feedURL == "" {
+		l.Fatal("error: IndieAuth requires -url")
+	}
+	if *archiveKeep < 0 {
+		l.Fatal("error: -archive-keep must not be negative")
+	}
 	if len(os.Getenv("TWTD_USR")) == 0 || len(os.Getenv("TWTD_PWD")) == 0 {
 		l.Fatal("error: You must supply basic auth credentials using the TWTD_USR and TWTD_PWD environment variables")
 	}
@@ -40,13 +67,86 @@ func main() {
 	runner := task.NewRunner(numWorkers)
 	defer runner.Stop()
 
+	lg := logger.New(l)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go task.Every(ctx, time.Minute, task.Inline, func(ctx context.Context) {
+		if err := db.FlushFollowers(); err != nil {
+			lg.FollowerLoggingErr(err)
+		}
+	})
+	if *archiveSize > 0 || *archiveAge > 0 {
+		policy := twt.ArchivePolicy{MaxSize: *archiveSize, MaxAge: *archiveAge, Keep: *archiveKeep}
+		go task.Every(ctx, *archiveInterval, runner.Enqueue, func(ctx context.Context) {
+			if _, err := db.Archive(policy, *feedURL, time.Now()); err != nil {
+				lg.ArchivingErr(err)
+			}
+		})
+	}
+
+	client := twt.NewPublicHTTPClient(30 * time.Second)
+	if *allowPrivate {
+		client = twt.NewHTTPClient(30 * time.Second)
+	}
+	agent := userAgent(*feedURL)
+	if *listInterval > 0 {
+		lists := twt.NewListFetcher(lg, db, runner.Enqueue, client, agent)
+		go task.Every(ctx, *listInterval, task.Inline, lists.FetchAll)
+	}
+	feeds := twt.NewFeedFetcher(lg, db, runner.Enqueue, client, agent)
+	if *timelineInterval > 0 {
+		go task.Every(ctx, *timelineInterval, task.Inline, feeds.FetchFollowing)
+	}
+	if *mentionsInterval > 0 {
+		go task.Every(ctx, *mentionsInterval, task.Inline, feeds.FetchFollowers)
+	}
+	if *verifyInterval > 0 {
+		if *feedURL == "" {
+			l.Fatal("error: follower verification requires -url")
+		}
+		verifier := twt.NewFollowerVerifier(lg, db, runner.Enqueue, client, agent, *feedURL)
+		go task.Every(ctx, *verifyInterval, task.Inline, verifier.VerifyAll)
+	}
+
 	l.Printf("listening on %s", *addr)
 	s := &http.Server{
 		Addr:    *addr,
-		Handler: twt.Handler(logger.New(l), db, twt.BasicAuth(os.Getenv("TWTD_USR"), os.Getenv("TWTD_PWD")), runner.Enqueue),
+		Handler: twt.Handler(lg, db, twt.BasicAuth(os.Getenv("TWTD_USR"), os.Getenv("TWTD_PWD")), runner.Enqueue, twt.WithFeedURL(*feedURL), twt.WithHTTPClient(client, agent), twt.WithHub(*hub), twt.WithMicropubToken(os.Getenv("TWTD_MICROPUB_TOKEN")), twt.WithIndieAuth(*authorizationEndpoint, *tokenEndpoint)),
 	}
 	defer s.Shutdown(context.Background())
 	if err := s.ListenAndServe(); err != nil {
 		l.Fatal(err.Error())
 	}
 }
+
+func archive(l *log.Logger, args []string) {
+	flags := flag.NewFlagSet("archive", flag.ExitOnError)
+	basedir := flags.String("dir", ".", "directory where the twtxt.txt file is located")
+	feedURL := flags.String("url", "", "public URL of twtxt.txt, used when it has no url metadata")
+	keep := flags.Int("keep", 20, "number of newest twts to keep in twtxt.txt")
+	_ = flags.Parse(args)
+	if *keep < 0 {
+		l.Fatal("error: -keep must not be negative")
+	}
+
+	db, err := twt.NewFileDB(*basedir)
+	if err != nil {
+		l.Fatalf("error initialize database: %s", err.Error())
+	}
+	name, err := db.Archive(twt.ArchivePolicy{Keep: *keep, Force: true}, *feedURL, time.Now())
+	if err != nil {
+		l.Fatalf("error archiving twts: %s", err.Error())
+	}
+	if name == "" {
+		l.Printf("nothing to archive")
+		return
+	}
+	l.Printf("archived twts to %s", filepath.Join(*basedir, name))
+}
+
+func userAgent(feedURL string) string {
+	if feedURL == "" {
+		return "twtd/" + version
+	}
+	return fmt.Sprintf("twtd/%s (+%s)", version, feedURL)
+}
@@ -0,0 +1,122 @@
+package twt
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const csrfCookie = "twtd_csrf"
+
+type composePage struct {
+	CSRFToken string
+	Text      string
+	Count     int
+	Preview   string
+	Error     string
+}
+
+func getComposeHandler(logger Logger) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		token, err := csrfToken(res, req)
+		if err != nil {
+			logger.WritingBodyErr(err)
+			res.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		writeCompose(logger, res, http.StatusOK, &composePage{CSRFToken: token})
+	}
+}
+
+func postComposeHandler(logger Logger, db DB, now func() time.Time, notify func(status []byte)) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		if !validCSRFToken(req) {
+			http.Error(res, "invalid CSRF token", http.StatusForbidden)
+			return
+		}
+		text := req.PostFormValue("text")
+		page := &composePage{CSRFToken: req.PostFormValue("csrf_token"), Text: text}
+		status, err := composeStatus(now(), text)
+		if err == nil {
+			err = ValidateStatus(status)
+		}
+		if err != nil {
+			page.Error = err.Error()
+			writeCompose(logger, res, http.StatusBadRequest, page)
+			return
+		}
+		page.Count = utf8.RuneCountInString(composeText(text))
+		page.Preview = strings.TrimSuffix(string(status), "\n")
+		if req.PostFormValue("action") == "preview" {
+			writeCompose(logger, res, http.StatusOK, page)
+			return
+		}
+		if err := db.PostStatus(bytes.NewReader(status)); err != nil {
+			logger.PostingStatusErr(err)
+			res.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		notify(status)
+		http.Redirect(res, req, "./", http.StatusSeeOther)
+	}
+}
+
+// composeText joins lines with the twtxt multiline separator.
+func composeText(text string) string {
+	text = strings.ReplaceAll(strings.TrimSpace(text), "\r\n", "\n")
+	return strings.ReplaceAll(text, "\n", "\u2028")
+}
+
+func composeStatus(now time.Time, text string) ([]byte, error) {
+	return timestampStatus(now, []byte(composeText(text)))
+}
+
+func writeCompose(logger Logger, res http.ResponseWriter, code int, page *composePage) {
+	buf := bytes.NewBuffer(nil)
+	if err := templates.ExecuteTemplate(buf, "compose.html", page); err != nil {
+		logger.WritingBodyErr(err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	res.Header().Set("Content-Type", "text/html; charset=utf-8")
+	res.Header().Set("Cache-Control", "no-store")
+	res.WriteHeader(code)
+	if _, err := res.Write(buf.Bytes()); err != nil {
+		logger.WritingBodyErr(err)
+	}
+}
+
+// csrfToken returns the token of the CSRF cookie, setting a new cookie when
+// the request has none.
+func csrfToken(res http.ResponseWriter, req *http.Request) (string, error) {
+	if cookie, err := req.Cookie(csrfCookie); err == nil && len(cookie.Value) == 32 {
+		return cookie.Value, nil
+	}
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	value := hex.EncodeToString(token)
+	http.SetCookie(res, &http.Cookie{
+		Name:     csrfCookie,
+		Value:    value,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   req.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+	return value, nil
+}
+
+func validCSRFToken(req *http.Request) bool {
+	cookie, err := req.Cookie(csrfCookie)
+	if err != nil || cookie.Value == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(req.PostFormValue("csrf_token"))) == 1
+}
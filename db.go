@@ -1,111 +1,805 @@
 package twt
 
 import (
+	"bufio"
 	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/m25n/twt/twtxt"
 	"io"
-	"log"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"sort"
 	"sync"
+	"time"
 )
 
 type DB interface {
 	Get() (io.ReadCloser, error)
 	PostStatus(io.Reader) error
+	Rewrite(func(*twtxt.Feed) error) error
+	GetArchive(name string) (io.ReadCloser, error)
 	LogFollower(string) error
+	LogListFollowers(list *MultiFollower, followers []*SingleFollower) error
+	ListFollowers() ([]FollowerRecord, error)
+	SetFollowerVerification(nick string, url string, status string, at time.Time) error
+	GetCachedFeed(url string) (*CachedFeed, error)
+	PutCachedFeed(*CachedFeed) error
+	ListCachedFeeds() ([]*CachedFeed, error)
+	PutWebmention(Webmention) error
+	DeleteWebmention(source string, target string) error
+	ListWebmentions() ([]Webmention, error)
+	PutSubscription(Subscription) error
+	DeleteSubscription(callback string) error
+	ListSubscriptions() ([]Subscription, error)
 }
 
 type FileDB struct {
+	basedir       string
 	twtxtFilepath string
 	twtxtMu       sync.RWMutex
 	twtxtCache    []byte
+	twtxtETag     string
+	twtxtModTime  time.Time
+	twtxtSize     int64
+	twtxtGzip     []byte
 
-	followers *log.Logger
+	followersFilepath string
+	followersMu       sync.Mutex
+	followers         map[string]*FollowerRecord
+	followersDirty    bool
+
+	feedsDir string
+	feedsMu  sync.Mutex
+	feeds    map[string]*cachedFeedMeta
+
+	webmentionsFilepath string
+	webmentionsMu       sync.Mutex
+	webmentions         map[string]Webmention
+
+	subscriptionsFilepath string
+	subscriptionsMu       sync.Mutex
+	subscriptions         map[string]Subscription
 }
 
 func NewFileDB(basedir string) (*FileDB, error) {
-	followers, err := createFollowersLog(basedir)
-	if err != nil {
+	f := &FileDB{
+		basedir:           basedir,
+		twtxtFilepath:     filepath.Join(basedir, "twtxt.txt"),
+		followersFilepath: filepath.Join(basedir, "followers.json"),
+		feedsDir:          filepath.Join(basedir, "feeds"),
+
+		webmentionsFilepath:   filepath.Join(basedir, "webmentions.json"),
+		subscriptionsFilepath: filepath.Join(basedir, "subscriptions.json"),
+	}
+	if err := f.loadFollowers(); err != nil {
+		return nil, err
+	}
+	if err := f.loadFeeds(); err != nil {
 		return nil, err
 	}
-	return &FileDB{
-		twtxtFilepath: filepath.Join(basedir, "twtxt.txt"),
-		followers:     followers,
-	}, nil
+	if err := f.loadWebmentions(); err != nil {
+		return nil, err
+	}
+	if err := f.loadSubscriptions(); err != nil {
+		return nil, err
+	}
+	return f, nil
 }
 
-func createFollowersLog(basedir string) (*log.Logger, error) {
-	followersFilepath := filepath.Join(basedir, "followers.log")
-	fh, err := os.OpenFile(followersFilepath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+func (f *FileDB) loadFollowers() error {
+	f.followers = map[string]*FollowerRecord{}
+	content, err := os.ReadFile(f.followersFilepath)
+	if err == nil {
+		var records []*FollowerRecord
+		if err := json.Unmarshal(content, &records); err != nil {
+			return err
+		}
+		for _, r := range records {
+			f.followers[r.key()] = r
+		}
+		return nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return f.migrateFollowersLog(filepath.Join(f.basedir, "followers.log"))
+}
+
+func (f *FileDB) migrateFollowersLog(logFilepath string) error {
+	fh, err := os.Open(logFilepath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
 	if err != nil {
-		return nil, err
+		return err
+	}
+	scanner := bufio.NewScanner(fh)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if len(line) < len(followersLogTimeLayout)+1 {
+			continue
+		}
+		seen, err := time.ParseInLocation(followersLogTimeLayout, line[:len(followersLogTimeLayout)], time.Local)
+		if err != nil {
+			continue
+		}
+		userAgent := line[len(followersLogTimeLayout)+1:]
+		for _, follower := range ParseFollowers(userAgent) {
+			f.recordFollower(follower, userAgent, seen)
+		}
+	}
+	_ = fh.Close()
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if err := f.saveFollowers(); err != nil {
+		return err
 	}
-	return log.New(fh, "", log.Ldate|log.Ltime), nil
+	return os.Rename(logFilepath, logFilepath+".migrated")
 }
 
+const followersLogTimeLayout = "2006/01/02 15:04:05"
+
 func (f *FileDB) LogFollower(userAgent string) error {
-	f.followers.Println(userAgent)
+	followers := ParseFollowers(userAgent)
+	if len(followers) == 0 {
+		return nil
+	}
+	f.followersMu.Lock()
+	defer f.followersMu.Unlock()
+	now := time.Now()
+	for _, follower := range followers {
+		f.recordFollower(follower, userAgent, now)
+	}
+	f.followersDirty = true
+	return nil
+}
+
+// LogListFollowers records followers found on list, each via the list.
+func (f *FileDB) LogListFollowers(list *MultiFollower, followers []*SingleFollower) error {
+	f.followersMu.Lock()
+	defer f.followersMu.Unlock()
+	now := time.Now()
+	for _, follower := range followers {
+		listed := *follower
+		listed.Via = list.ListURL
+		f.recordFollower(&listed, "", now)
+	}
+	f.followersDirty = true
+	return nil
+}
+
+// FlushFollowers writes the followers recorded since the last flush to
+// followers.json.
+func (f *FileDB) FlushFollowers() error {
+	f.followersMu.Lock()
+	defer f.followersMu.Unlock()
+	if !f.followersDirty {
+		return nil
+	}
+	if err := f.saveFollowers(); err != nil {
+		return err
+	}
+	f.followersDirty = false
+	return nil
+}
+
+// recordFollower counts a fetch by follower, keeping the last user agent when
+// userAgent is empty. The caller must hold followersMu.
+func (f *FileDB) recordFollower(follower Follower, userAgent string, seen time.Time) {
+	fetched := newFollowerRecord(follower)
+	record, ok := f.followers[fetched.key()]
+	if !ok {
+		record = fetched
+		record.FirstSeen = seen
+		f.followers[record.key()] = record
+	}
+	if seen.After(record.LastSeen) {
+		record.LastSeen = seen
+		if userAgent != "" {
+			record.UserAgent = userAgent
+		}
+		record.URL = fetched.URL
+		record.ContactURL = fetched.ContactURL
+		record.Count = fetched.Count
+		record.Via = fetched.Via
+	}
+	record.Fetches++
+}
+
+// saveFollowers writes followers.json. The caller must hold followersMu.
+func (f *FileDB) saveFollowers() error {
+	content, err := json.MarshalIndent(f.sortedFollowers(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(f.followersFilepath, content, 0600)
+}
+
+func (f *FileDB) sortedFollowers() []FollowerRecord {
+	records := make([]FollowerRecord, 0, len(f.followers))
+	for _, r := range f.followers {
+		records = append(records, *r)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if !records[i].FirstSeen.Equal(records[j].FirstSeen) {
+			return records[i].FirstSeen.Before(records[j].FirstSeen)
+		}
+		return records[i].key() < records[j].key()
+	})
+	return records
+}
+
+func (f *FileDB) SetFollowerVerification(nick string, url string, status string, at time.Time) error {
+	f.followersMu.Lock()
+	defer f.followersMu.Unlock()
+	record, ok := f.followers[(&FollowerRecord{Nick: nick, URL: url}).key()]
+	if !ok {
+		return FollowerNotFoundErr
+	}
+	record.Verification = status
+	record.VerifiedAt = &at
+	f.followersDirty = true
+	return nil
+}
+
+func (f *FileDB) ListFollowers() ([]FollowerRecord, error) {
+	f.followersMu.Lock()
+	defer f.followersMu.Unlock()
+	return f.sortedFollowers(), nil
+}
+
+const (
+	maxCachedFeeds = 1000
+	cachedFeedTTL  = 30 * 24 * time.Hour
+)
+
+// cachedFeedMeta is kept apart from the content of a cached feed, so an
+// unchanged feed only rewrites its metadata.
+type cachedFeedMeta struct {
+	CachedFeed
+	ContentSHA256 string `json:"content_sha256"`
+}
+
+func (f *FileDB) cachedFeedFilepath(url string, ext string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(f.feedsDir, hex.EncodeToString(sum[:16])+ext)
+}
+
+func (f *FileDB) loadFeeds() error {
+	f.feeds = map[string]*cachedFeedMeta{}
+	entries, err := os.ReadDir(f.feedsDir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	for _, entry := range entries {
+		if filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		meta := &cachedFeedMeta{}
+		if err := loadJSON(filepath.Join(f.feedsDir, entry.Name()), meta); err != nil {
+			return err
+		}
+		f.feeds[meta.URL] = meta
+	}
+	return nil
+}
+
+// GetCachedFeed returns the cached copy of the remote feed at url, or nil when
+// it was never fetched.
+func (f *FileDB) GetCachedFeed(url string) (*CachedFeed, error) {
+	f.feedsMu.Lock()
+	defer f.feedsMu.Unlock()
+	meta, ok := f.feeds[url]
+	if !ok {
+		return nil, nil
+	}
+	return f.readCachedFeed(meta)
+}
+
+// PutCachedFeed caches feed and drops the feeds that expired by the time it
+// was fetched.
+func (f *FileDB) PutCachedFeed(feed *CachedFeed) error {
+	f.feedsMu.Lock()
+	defer f.feedsMu.Unlock()
+	if err := f.putCachedFeed(feed); err != nil {
+		return err
+	}
+	return f.expireFeeds(feed.FetchedAt)
+}
+
+// putCachedFeed writes the metadata of feed, and its content when it changed.
+// The caller must hold feedsMu.
+func (f *FileDB) putCachedFeed(feed *CachedFeed) error {
+	if err := os.MkdirAll(f.feedsDir, 0755); err != nil {
+		return err
+	}
+	sum := sha256.Sum256([]byte(feed.Content))
+	meta := &cachedFeedMeta{CachedFeed: *feed, ContentSHA256: hex.EncodeToString(sum[:])}
+	meta.Content = ""
+	if old, ok := f.feeds[feed.URL]; !ok || old.ContentSHA256 != meta.ContentSHA256 {
+		if err := writeFileAtomic(f.cachedFeedFilepath(feed.URL, ".txt"), []byte(feed.Content), 0644); err != nil {
+			return err
+		}
+	}
+	if err := saveJSON(f.cachedFeedFilepath(feed.URL, ".json"), meta, 0644); err != nil {
+		return err
+	}
+	f.feeds[feed.URL] = meta
+	return nil
+}
+
+// expireFeeds drops the feeds past cachedFeedTTL or maxCachedFeeds. The caller
+// must hold feedsMu.
+func (f *FileDB) expireFeeds(now time.Time) error {
+	metas := make([]*cachedFeedMeta, 0, len(f.feeds))
+	for _, meta := range f.feeds {
+		metas = append(metas, meta)
+	}
+	sort.Slice(metas, func(i, j int) bool {
+		if !metas[i].FetchedAt.Equal(metas[j].FetchedAt) {
+			return metas[i].FetchedAt.After(metas[j].FetchedAt)
+		}
+		return metas[i].URL < metas[j].URL
+	})
+	for i, meta := range metas {
+		if i < maxCachedFeeds && now.Sub(meta.FetchedAt) <= cachedFeedTTL {
+			continue
+		}
+		for _, ext := range []string{".json", ".txt"} {
+			if err := os.Remove(f.cachedFeedFilepath(meta.URL, ext)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+		}
+		delete(f.feeds, meta.URL)
+	}
+	return nil
+}
+
+func (f *FileDB) ListCachedFeeds() ([]*CachedFeed, error) {
+	f.feedsMu.Lock()
+	defer f.feedsMu.Unlock()
+	urls := make([]string, 0, len(f.feeds))
+	for url := range f.feeds {
+		urls = append(urls, url)
+	}
+	sort.Strings(urls)
+	feeds := make([]*CachedFeed, 0, len(urls))
+	for _, url := range urls {
+		cached, err := f.readCachedFeed(f.feeds[url])
+		if err != nil {
+			return nil, err
+		}
+		feeds = append(feeds, cached)
+	}
+	return feeds, nil
+}
+
+// readCachedFeed reads the content of a cached feed. The caller must hold
+// feedsMu.
+func (f *FileDB) readCachedFeed(meta *cachedFeedMeta) (*CachedFeed, error) {
+	content, err := os.ReadFile(f.cachedFeedFilepath(meta.URL, ".txt"))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	cached := meta.CachedFeed
+	cached.Content = string(content)
+	return &cached, nil
+}
+
+func (f *FileDB) loadWebmentions() error {
+	var mentions []Webmention
+	if err := loadJSON(f.webmentionsFilepath, &mentions); err != nil {
+		return err
+	}
+	f.webmentions = make(map[string]Webmention, len(mentions))
+	for _, m := range mentions {
+		f.webmentions[m.key()] = m
+	}
+	return nil
+}
+
+// PutWebmention stores mention, keeping when a mention from the same source
+// was first received.
+func (f *FileDB) PutWebmention(mention Webmention) error {
+	f.webmentionsMu.Lock()
+	defer f.webmentionsMu.Unlock()
+	if existing, ok := f.webmentions[mention.key()]; ok {
+		mention.ReceivedAt = existing.ReceivedAt
+	}
+	f.webmentions[mention.key()] = mention
+	return saveJSON(f.webmentionsFilepath, f.sortedWebmentions(), 0600)
+}
+
+func (f *FileDB) DeleteWebmention(source string, target string) error {
+	f.webmentionsMu.Lock()
+	defer f.webmentionsMu.Unlock()
+	key := Webmention{Source: source, Target: target}.key()
+	if _, ok := f.webmentions[key]; !ok {
+		return nil
+	}
+	delete(f.webmentions, key)
+	return saveJSON(f.webmentionsFilepath, f.sortedWebmentions(), 0600)
+}
+
+func (f *FileDB) ListWebmentions() ([]Webmention, error) {
+	f.webmentionsMu.Lock()
+	defer f.webmentionsMu.Unlock()
+	return f.sortedWebmentions(), nil
+}
+
+// sortedWebmentions copies the webmentions ordered by source and target. The
+// caller must hold webmentionsMu.
+func (f *FileDB) sortedWebmentions() []Webmention {
+	mentions := make([]Webmention, 0, len(f.webmentions))
+	for _, m := range f.webmentions {
+		mentions = append(mentions, m)
+	}
+	sort.Slice(mentions, func(i, j int) bool {
+		return mentions[i].key() < mentions[j].key()
+	})
+	return mentions
+}
+
+func (f *FileDB) loadSubscriptions() error {
+	var subs []Subscription
+	if err := loadJSON(f.subscriptionsFilepath, &subs); err != nil {
+		return err
+	}
+	f.subscriptions = make(map[string]Subscription, len(subs))
+	for _, sub := range subs {
+		f.subscriptions[sub.Callback] = sub
+	}
 	return nil
 }
 
+// PutSubscription stores sub, replacing an earlier subscription of the same
+// callback.
+func (f *FileDB) PutSubscription(sub Subscription) error {
+	f.subscriptionsMu.Lock()
+	defer f.subscriptionsMu.Unlock()
+	f.subscriptions[sub.Callback] = sub
+	return saveJSON(f.subscriptionsFilepath, f.sortedSubscriptions(), 0600)
+}
+
+func (f *FileDB) DeleteSubscription(callback string) error {
+	f.subscriptionsMu.Lock()
+	defer f.subscriptionsMu.Unlock()
+	if _, ok := f.subscriptions[callback]; !ok {
+		return nil
+	}
+	delete(f.subscriptions, callback)
+	return saveJSON(f.subscriptionsFilepath, f.sortedSubscriptions(), 0600)
+}
+
+func (f *FileDB) ListSubscriptions() ([]Subscription, error) {
+	f.subscriptionsMu.Lock()
+	defer f.subscriptionsMu.Unlock()
+	return f.sortedSubscriptions(), nil
+}
+
+// sortedSubscriptions copies the subscriptions ordered by callback. The caller
+// must hold subscriptionsMu.
+func (f *FileDB) sortedSubscriptions() []Subscription {
+	subs := make([]Subscription, 0, len(f.subscriptions))
+	for _, sub := range f.subscriptions {
+		subs = append(subs, sub)
+	}
+	sort.Slice(subs, func(i, j int) bool {
+		return subs[i].Callback < subs[j].Callback
+	})
+	return subs
+}
+
+// Get serves twtxt.txt from memory, reloading it when the file changed on disk.
 func (f *FileDB) Get() (io.ReadCloser, error) {
 	f.twtxtMu.RLock()
-	if len(f.twtxtCache) == 0 {
+	if len(f.twtxtCache) == 0 || f.cacheIsStale() {
 		f.twtxtMu.RUnlock()
 		if err := f.loadCache(); err != nil {
 			return nil, err
 		}
 		f.twtxtMu.RLock()
 	}
-	return &unlockableReader{bytes.NewBuffer(f.twtxtCache), &f.twtxtMu}, nil
+	return &unlockableReader{bytes.NewReader(f.twtxtCache), &f.twtxtMu, f.twtxtETag, f.twtxtModTime, f.twtxtGzip}, nil
 }
 
 func (f *FileDB) loadCache() error {
 	f.twtxtMu.Lock()
 	defer f.twtxtMu.Unlock()
-	if len(f.twtxtCache) == 0 {
+	if len(f.twtxtCache) == 0 || f.cacheIsStale() {
 		fh, err := os.Open(f.twtxtFilepath)
 		if err != nil {
 			return err
 		}
-		buf := bytes.NewBuffer(f.twtxtCache)
+		buf := bytes.NewBuffer(nil)
 		_, err = io.Copy(buf, fh)
+		if err != nil {
+			_ = fh.Close()
+			return err
+		}
+		info, err := fh.Stat()
 		_ = fh.Close()
 		if err != nil {
 			return err
 		}
-		f.twtxtCache = buf.Bytes()
+		f.setCache(buf.Bytes(), info)
 	}
 	return nil
 }
 
+// cacheIsStale reports whether twtxt.txt on disk differs in size or
+// modification time from the cached copy. The caller must hold twtxtMu.
+func (f *FileDB) cacheIsStale() bool {
+	info, err := os.Stat(f.twtxtFilepath)
+	if err != nil {
+		return false
+	}
+	return info.Size() != f.twtxtSize || !info.ModTime().Equal(f.twtxtModTime)
+}
+
+// setCache caches content along with a gzipped copy. info describes the file
+// it was read from or written to. The caller must hold twtxtMu.
+func (f *FileDB) setCache(content []byte, info fs.FileInfo) {
+	sum := sha256.Sum256(content)
+	f.twtxtCache = content
+	f.twtxtETag = `"` + hex.EncodeToString(sum[:16]) + `"`
+	f.twtxtModTime = info.ModTime()
+	f.twtxtSize = info.Size()
+	f.twtxtGzip, _ = gzipBytes(content)
+}
+
+func gzipBytes(content []byte) ([]byte, error) {
+	buf := bytes.NewBuffer(nil)
+	zw, err := gzip.NewWriterLevel(buf, gzip.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := zw.Write(content); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// PostStatus reads and validates the whole status before committing it, so a
+// failing reader or malformed input never leaves a partial line in twtxt.txt.
 func (f *FileDB) PostStatus(statusLine io.Reader) error {
+	status, err := io.ReadAll(statusLine)
+	if err != nil {
+		return err
+	}
+	if err := ValidateStatus(status); err != nil {
+		return err
+	}
 	f.twtxtMu.Lock()
 	defer f.twtxtMu.Unlock()
-	f.twtxtCache = f.twtxtCache[:0]
-	fh, err := os.OpenFile(f.twtxtFilepath, os.O_APPEND, 0666)
+	content, err := f.readTwtxt()
 	if err != nil {
 		return err
 	}
-	_, err = io.Copy(fh, statusLine)
-	_ = fh.Close()
-	return err
+	updated := make([]byte, 0, len(content)+len(status)+1)
+	updated = append(updated, content...)
+	if len(updated) > 0 && updated[len(updated)-1] != '\n' {
+		updated = append(updated, '\n')
+	}
+	updated = append(updated, status...)
+	return f.writeTwtxt(updated)
+}
+
+// Rewrite parses twtxt.txt, lets fn modify it and atomically replaces the file
+// with the result. Nothing is written if fn returns an error.
+func (f *FileDB) Rewrite(fn func(*twtxt.Feed) error) error {
+	f.twtxtMu.Lock()
+	defer f.twtxtMu.Unlock()
+	content, err := f.readTwtxt()
+	if err != nil {
+		return err
+	}
+	feed, err := twtxt.ParseLenient(bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+	if err := fn(feed); err != nil {
+		return err
+	}
+	buf := bytes.NewBuffer(nil)
+	if _, err := feed.WriteTo(buf); err != nil {
+		return err
+	}
+	return f.writeTwtxt(buf.Bytes())
+}
+
+var nothingToArchiveErr = errors.New("nothing to archive")
+
+// Archive moves the twts selected by policy into a new archive linked from
+// twtxt.txt by "# prev =" metadata. It returns the archive name, or an empty
+// string when no twts were selected.
+func (f *FileDB) Archive(policy ArchivePolicy, fallbackURL string, now time.Time) (string, error) {
+	var name string
+	err := f.Rewrite(func(feed *twtxt.Feed) error {
+		selected := policy.selectTwts(feed, now)
+		archive := splitArchive(feed, selected)
+		if len(archive.Twts) == 0 {
+			return nothingToArchiveErr
+		}
+		hash := newestTwt(archive.Twts).Hash(feedURL(feed, fallbackURL))
+		name = archiveName(hash)
+		if err := writeFileAtomic(filepath.Join(f.basedir, name), writeFeed(archive), 0644); err != nil {
+			return err
+		}
+		feed.SetMetadata("prev", hash+" "+name)
+		return nil
+	})
+	if errors.Is(err, nothingToArchiveErr) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+func (f *FileDB) GetArchive(name string) (io.ReadCloser, error) {
+	if !archiveNameRegex.MatchString(name) {
+		return nil, ArchiveNotFoundErr
+	}
+	fh, err := os.Open(filepath.Join(f.basedir, name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ArchiveNotFoundErr
+	}
+	return fh, err
+}
+
+// readTwtxt reads twtxt.txt from disk, treating a missing file as empty. The
+// caller must hold twtxtMu for writing.
+func (f *FileDB) readTwtxt() ([]byte, error) {
+	content, err := os.ReadFile(f.twtxtFilepath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return content, err
+}
+
+// writeTwtxt atomically replaces twtxt.txt with content and caches it. The
+// caller must hold twtxtMu for writing.
+func (f *FileDB) writeTwtxt(content []byte) error {
+	if err := writeFileAtomic(f.twtxtFilepath, content, 0644); err != nil {
+		return err
+	}
+	info, err := os.Stat(f.twtxtFilepath)
+	if err != nil {
+		return err
+	}
+	f.setCache(content, info)
+	return nil
+}
+
+// loadJSON decodes the JSON file at filename into v, leaving v untouched when
+// the file does not exist.
+func loadJSON(filename string, v interface{}) error {
+	content, err := os.ReadFile(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(content, v)
+}
+
+func saveJSON(filename string, v interface{}, perm fs.FileMode) error {
+	content, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filename, content, perm)
+}
+
+// writeFileAtomic replaces filename with content through a synced temporary
+// file. New files get perm, existing files keep theirs.
+func writeFileAtomic(filename string, content []byte, perm fs.FileMode) error {
+	mode := perm
+	if info, err := os.Stat(filename); err == nil {
+		mode = info.Mode().Perm()
+	}
+	fh, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".*")
+	if err != nil {
+		return err
+	}
+	tmpFilepath := fh.Name()
+	defer os.Remove(tmpFilepath)
+	if _, err := fh.Write(content); err != nil {
+		_ = fh.Close()
+		return err
+	}
+	if err := fh.Chmod(mode); err != nil {
+		_ = fh.Close()
+		return err
+	}
+	if err := fh.Sync(); err != nil {
+		_ = fh.Close()
+		return err
+	}
+	if err := fh.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpFilepath, filename); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(filename))
+}
+
+// syncDir flushes a directory, making a rename within it durable.
+func syncDir(dir string) error {
+	fh, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	if err := fh.Sync(); err != nil {
+		_ = fh.Close()
+		return err
+	}
+	return fh.Close()
 }
 
 type runlocker interface {
 	RUnlock()
 }
 
+// Versioned is implemented by readers returned from DB.Get that know which
+// version of twtxt.txt they hold.
+type Versioned interface {
+	ETag() string
+	ModTime() time.Time
+}
+
+// Precompressed is implemented by readers returned from DB.Get that hold
+// compressed copies of their content. Encoded returns the content in the given
+// content coding, if available.
+type Precompressed interface {
+	Encoded(encoding string) (io.ReadSeeker, bool)
+}
+
 type unlockableReader struct {
-	r  io.Reader
-	ul runlocker
+	r       *bytes.Reader
+	ul      runlocker
+	etag    string
+	modTime time.Time
+	gzip    []byte
 }
 
 func (u *unlockableReader) Read(p []byte) (n int, err error) {
 	return u.r.Read(p)
 }
 
+func (u *unlockableReader) Seek(offset int64, whence int) (int64, error) {
+	return u.r.Seek(offset, whence)
+}
+
 func (u *unlockableReader) Close() error {
 	u.ul.RUnlock()
 	return nil
 }
+
+func (u *unlockableReader) ETag() string {
+	return u.etag
+}
+
+func (u *unlockableReader) ModTime() time.Time {
+	return u.modTime
+}
+
+func (u *unlockableReader) Encoded(encoding string) (io.ReadSeeker, bool) {
+	if encoding != "gzip" || u.gzip == nil {
+		return nil, false
+	}
+	return bytes.NewReader(u.gzip), true
+}
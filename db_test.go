@@ -0,0 +1,511 @@
+package twt_test
+
+import (
+	"compress/gzip"
+	"errors"
+	"github.com/m25n/twt"
+	"github.com/m25n/twt/testhelper"
+	"github.com/m25n/twt/twtxt"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileDB(t *testing.T) {
+	t.Run("posting status", func(t *testing.T) {
+		t.Run("appends the status", func(t *testing.T) {
+			dir := t.TempDir()
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "twtxt.txt"), []byte(status), 0644))
+			db, _ := twt.NewFileDB(dir)
+			next := "2022-01-02T00:00:00Z\tAnother thought\n"
+
+			err := db.PostStatus(strings.NewReader(next))
+
+			require.NoError(t, err)
+			require.Equal(t, status+next, readTwtxt(t, dir))
+			require.Equal(t, status+next, readDB(t, db))
+		})
+
+		t.Run("creates a missing twtxt.txt", func(t *testing.T) {
+			dir := t.TempDir()
+			db, _ := twt.NewFileDB(dir)
+
+			err := db.PostStatus(strings.NewReader(status))
+
+			require.NoError(t, err)
+			require.Equal(t, status, readTwtxt(t, dir))
+		})
+
+		t.Run("terminates an unfinished last line", func(t *testing.T) {
+			dir := t.TempDir()
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "twtxt.txt"), []byte("# nick = somebody"), 0644))
+			db, _ := twt.NewFileDB(dir)
+
+			_ = db.PostStatus(strings.NewReader(status))
+
+			require.Equal(t, "# nick = somebody\n"+status, readTwtxt(t, dir))
+		})
+
+		t.Run("leaves the file untouched when the reader fails", func(t *testing.T) {
+			dir := t.TempDir()
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "twtxt.txt"), []byte(status), 0644))
+			db, _ := twt.NewFileDB(dir)
+			readErr := errors.New("read error")
+
+			err := db.PostStatus(io.MultiReader(strings.NewReader("2022-01-02T00:00:00Z\tAnoth"), &testhelper.StubReader{ReadErr: readErr}))
+
+			require.ErrorIs(t, err, readErr)
+			require.Equal(t, status, readTwtxt(t, dir))
+			require.Equal(t, status, readDB(t, db))
+		})
+
+		t.Run("rejects malformed statuses", func(t *testing.T) {
+			dir := t.TempDir()
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "twtxt.txt"), []byte(status), 0644))
+			db, _ := twt.NewFileDB(dir)
+
+			err := db.PostStatus(strings.NewReader("2022-01-02T00:00:00Z\tAnother thought"))
+
+			var invalidErr *twt.InvalidStatusErr
+			require.True(t, errors.As(err, &invalidErr))
+			require.Equal(t, status, readTwtxt(t, dir))
+		})
+
+		t.Run("leaves no temporary files behind", func(t *testing.T) {
+			dir := t.TempDir()
+			db, _ := twt.NewFileDB(dir)
+
+			_ = db.PostStatus(strings.NewReader(status))
+
+			entries, err := os.ReadDir(dir)
+			require.NoError(t, err)
+			var names []string
+			for _, entry := range entries {
+				names = append(names, entry.Name())
+			}
+			require.ElementsMatch(t, []string{"twtxt.txt"}, names)
+		})
+	})
+
+	t.Run("versions the cached twtxt.txt", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "twtxt.txt"), []byte(status), 0644))
+		db, _ := twt.NewFileDB(dir)
+		version := func() (string, time.Time) {
+			file, err := db.Get()
+			require.NoError(t, err)
+			defer file.Close()
+			v, ok := file.(twt.Versioned)
+			require.True(t, ok)
+			return v.ETag(), v.ModTime()
+		}
+
+		etag, modTime := version()
+		sameETag, sameModTime := version()
+		_ = db.PostStatus(strings.NewReader("2022-01-02T00:00:00Z\tAnother thought\n"))
+		newETag, _ := version()
+
+		require.NotEmpty(t, etag)
+		require.False(t, modTime.IsZero())
+		require.Equal(t, etag, sameETag)
+		require.Equal(t, modTime, sameModTime)
+		require.NotEqual(t, etag, newETag)
+	})
+
+	t.Run("picks up changes made to twtxt.txt on disk", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "twtxt.txt"), []byte(status), 0644))
+		db, _ := twt.NewFileDB(dir)
+		require.Equal(t, status, readDB(t, db))
+		edited := "# nick = somebody\n" + status
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "twtxt.txt"), []byte(edited), 0644))
+
+		served := readDB(t, db)
+		err := db.PostStatus(strings.NewReader("2022-01-02T00:00:00Z\tAnother thought\n"))
+
+		require.NoError(t, err)
+		require.Equal(t, edited, served)
+		require.Equal(t, edited+"2022-01-02T00:00:00Z\tAnother thought\n", readTwtxt(t, dir))
+		require.Equal(t, edited+"2022-01-02T00:00:00Z\tAnother thought\n", readDB(t, db))
+	})
+
+	t.Run("does not overwrite changes made on disk when rewriting", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "twtxt.txt"), []byte(status), 0644))
+		db, _ := twt.NewFileDB(dir)
+		require.Equal(t, status, readDB(t, db))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "twtxt.txt"), []byte(status+"2022-01-02T00:00:00Z\tAnother thought\n"), 0644))
+
+		err := db.Rewrite(func(feed *twtxt.Feed) error {
+			feed.SetMetadata("nick", "someone")
+			return nil
+		})
+
+		require.NoError(t, err)
+		require.Equal(t, "# nick = someone\n"+status+"2022-01-02T00:00:00Z\tAnother thought\n", readTwtxt(t, dir))
+	})
+
+	t.Run("keeps a gzipped copy of the cached twtxt.txt", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "twtxt.txt"), []byte(status), 0644))
+		db, _ := twt.NewFileDB(dir)
+		gunzip := func() string {
+			file, err := db.Get()
+			require.NoError(t, err)
+			defer file.Close()
+			encoded, ok := file.(twt.Precompressed).Encoded("gzip")
+			require.True(t, ok)
+			zr, err := gzip.NewReader(encoded)
+			require.NoError(t, err)
+			content, err := io.ReadAll(zr)
+			require.NoError(t, err)
+			return string(content)
+		}
+
+		before := gunzip()
+		_ = db.PostStatus(strings.NewReader("2022-01-02T00:00:00Z\tAnother thought\n"))
+		after := gunzip()
+
+		require.Equal(t, status, before)
+		require.Equal(t, status+"2022-01-02T00:00:00Z\tAnother thought\n", after)
+	})
+
+	t.Run("rewrites metadata while preserving status lines", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "twtxt.txt"), []byte("# nick = somebody\n"+status), 0644))
+		db, err := twt.NewFileDB(dir)
+		require.NoError(t, err)
+
+		err = db.Rewrite(func(feed *twtxt.Feed) error {
+			feed.SetMetadata("nick", "someone")
+			return nil
+		})
+
+		require.NoError(t, err)
+		require.Equal(t, "# nick = someone\n"+status, readTwtxt(t, dir))
+		require.Equal(t, "# nick = someone\n"+status, readDB(t, db))
+	})
+
+	t.Run("carries lines that are not twts through a rewrite", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "twtxt.txt"), []byte("not a twt\n"+status), 0644))
+		db, _ := twt.NewFileDB(dir)
+
+		err := db.Rewrite(func(feed *twtxt.Feed) error {
+			feed.SetMetadata("nick", "someone")
+			return nil
+		})
+
+		require.NoError(t, err)
+		require.Equal(t, "# nick = someone\nnot a twt\n"+status, readTwtxt(t, dir))
+	})
+
+	t.Run("leaves the file untouched when a rewrite fails", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "twtxt.txt"), []byte(status), 0644))
+		db, _ := twt.NewFileDB(dir)
+
+		err := db.Rewrite(func(feed *twtxt.Feed) error {
+			feed.Twts = nil
+			return os.ErrInvalid
+		})
+
+		require.ErrorIs(t, err, os.ErrInvalid)
+		require.Equal(t, status, readTwtxt(t, dir))
+	})
+}
+
+func TestFileDBArchive(t *testing.T) {
+	const (
+		first  = "2022-01-01T00:00:00Z\tFirst\n"
+		second = "2022-01-02T00:00:00Z\tSecond\n"
+		third  = "2022-01-03T00:00:00Z\tThird\n"
+	)
+	now := time.Date(2022, 1, 3, 12, 0, 0, 0, time.UTC)
+	newDB := func(t *testing.T) (*twt.FileDB, string) {
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "twtxt.txt"), []byte("# nick = somebody\n"+first+second+third), 0644))
+		db, err := twt.NewFileDB(dir)
+		require.NoError(t, err)
+		return db, dir
+	}
+
+	t.Run("moves twts older than the max age into an archive", func(t *testing.T) {
+		db, dir := newDB(t)
+
+		name, err := db.Archive(twt.ArchivePolicy{MaxAge: 24 * time.Hour}, "https://example.com/twtxt.txt", now)
+
+		require.NoError(t, err)
+		hash := twtHash(t, second, "https://example.com/twtxt.txt")
+		require.Equal(t, "twtxt-"+hash+".txt", name)
+		require.Equal(t, "# nick = somebody\n# prev = "+hash+" "+name+"\n"+third, readTwtxt(t, dir))
+		archive, err := db.GetArchive(name)
+		require.NoError(t, err)
+		defer archive.Close()
+		content, _ := io.ReadAll(archive)
+		require.Equal(t, "# nick = somebody\n"+first+second, string(content))
+	})
+
+	t.Run("moves all but the kept twts when the feed is too large", func(t *testing.T) {
+		db, dir := newDB(t)
+
+		name, err := db.Archive(twt.ArchivePolicy{MaxSize: 10, Keep: 2}, "https://example.com/twtxt.txt", now)
+
+		require.NoError(t, err)
+		require.Equal(t, "# nick = somebody\n# prev = "+twtHash(t, first, "https://example.com/twtxt.txt")+" "+name+"\n"+second+third, readTwtxt(t, dir))
+	})
+
+	t.Run("treats a negative keep as zero", func(t *testing.T) {
+		db, dir := newDB(t)
+
+		name, err := db.Archive(twt.ArchivePolicy{Keep: -1, Force: true}, "https://example.com/twtxt.txt", now)
+
+		require.NoError(t, err)
+		require.Equal(t, "# nick = somebody\n# prev = "+twtHash(t, third, "https://example.com/twtxt.txt")+" "+name+"\n", readTwtxt(t, dir))
+	})
+
+	t.Run("does nothing when no thresholds are exceeded", func(t *testing.T) {
+		db, dir := newDB(t)
+
+		name, err := db.Archive(twt.ArchivePolicy{MaxSize: 1024, MaxAge: 7 * 24 * time.Hour}, "https://example.com/twtxt.txt", now)
+
+		require.NoError(t, err)
+		require.Empty(t, name)
+		require.Equal(t, "# nick = somebody\n"+first+second+third, readTwtxt(t, dir))
+	})
+
+	t.Run("chains archives through prev metadata", func(t *testing.T) {
+		db, dir := newDB(t)
+		firstName, _ := db.Archive(twt.ArchivePolicy{Keep: 2, Force: true}, "https://example.com/twtxt.txt", now)
+
+		secondName, err := db.Archive(twt.ArchivePolicy{Keep: 1, Force: true}, "https://example.com/twtxt.txt", now)
+
+		require.NoError(t, err)
+		require.Equal(t, "# nick = somebody\n# prev = "+twtHash(t, second, "https://example.com/twtxt.txt")+" "+secondName+"\n"+third, readTwtxt(t, dir))
+		archive, _ := db.GetArchive(secondName)
+		defer archive.Close()
+		content, _ := io.ReadAll(archive)
+		require.Equal(t, "# nick = somebody\n# prev = "+twtHash(t, first, "https://example.com/twtxt.txt")+" "+firstName+"\n"+second, string(content))
+	})
+
+	t.Run("does not serve other files as archives", func(t *testing.T) {
+		db, _ := newDB(t)
+
+		for _, name := range []string{"twtxt.txt", "followers.log", "../twtxt-abcdefg.txt", "twtxt-abcdefg.txt"} {
+			_, err := db.GetArchive(name)
+
+			require.ErrorIs(t, err, twt.ArchiveNotFoundErr)
+		}
+	})
+}
+
+func TestFileDBFollowers(t *testing.T) {
+	const (
+		somebody = "twtxt/1.2.3 (+https://example.com/twtxt.txt; @somebody)"
+		pod      = "yarnd/0.1.0 (~https://pod.example.com/whoFollows?token=abc; contact=https://pod.example.com/support)"
+	)
+
+	t.Run("deduplicates followers and counts their fetches", func(t *testing.T) {
+		db, _ := twt.NewFileDB(t.TempDir())
+		before := time.Now()
+
+		require.NoError(t, db.LogFollower(somebody))
+		require.NoError(t, db.LogFollower(pod))
+		require.NoError(t, db.LogFollower("twtxt/1.2.4 (+https://example.com/twtxt.txt; @somebody)"))
+
+		followers, err := db.ListFollowers()
+		require.NoError(t, err)
+		require.Len(t, followers, 2)
+		require.Equal(t, "somebody", followers[0].Nick)
+		require.Equal(t, "https://example.com/twtxt.txt", followers[0].URL)
+		require.Equal(t, 2, followers[0].Fetches)
+		require.Equal(t, "twtxt/1.2.4 (+https://example.com/twtxt.txt; @somebody)", followers[0].UserAgent)
+		require.False(t, followers[0].FirstSeen.Before(before))
+		require.False(t, followers[0].LastSeen.Before(followers[0].FirstSeen))
+		require.Equal(t, "https://pod.example.com/whoFollows?token=abc", followers[1].URL)
+		require.Equal(t, "https://pod.example.com/support", followers[1].ContactURL)
+	})
+
+	t.Run("records a list once while its token and count change", func(t *testing.T) {
+		db, _ := twt.NewFileDB(t.TempDir())
+
+		require.NoError(t, db.LogFollower("yarnd/0.13.0 (~https://pod.example.com/whoFollows?followers=1&token=abc; contact=https://pod.example.com/support)"))
+		require.NoError(t, db.LogFollower("yarnd/0.13.0 (~https://pod.example.com/whoFollows?followers=2&token=def; contact=https://pod.example.com/support)"))
+
+		followers, _ := db.ListFollowers()
+		require.Len(t, followers, 1)
+		require.Equal(t, "https://pod.example.com/whoFollows?followers=2&token=def", followers[0].URL)
+		require.Equal(t, 2, followers[0].Count)
+		require.Equal(t, 2, followers[0].Fetches)
+	})
+
+	t.Run("records list followers via the list", func(t *testing.T) {
+		db, _ := twt.NewFileDB(t.TempDir())
+		require.NoError(t, db.LogFollower(somebody))
+		listURL, _ := url.Parse("https://pod.example.com/whoFollows")
+		feedURL, _ := url.Parse("https://example.com/twtxt.txt")
+
+		err := db.LogListFollowers(&twt.MultiFollower{ListURL: listURL}, []*twt.SingleFollower{{Nick: "somebody", URL: feedURL}})
+
+		require.NoError(t, err)
+		followers, _ := db.ListFollowers()
+		require.Len(t, followers, 1)
+		require.Equal(t, 2, followers[0].Fetches)
+		require.Equal(t, listURL.String(), followers[0].Via)
+		require.Equal(t, somebody, followers[0].UserAgent)
+	})
+
+	t.Run("ignores user agents that are not followers", func(t *testing.T) {
+		db, _ := twt.NewFileDB(t.TempDir())
+
+		require.NoError(t, db.LogFollower("curl/7.79.1"))
+
+		followers, _ := db.ListFollowers()
+		require.Empty(t, followers)
+	})
+
+	t.Run("persists followers when flushed", func(t *testing.T) {
+		dir := t.TempDir()
+		db, _ := twt.NewFileDB(dir)
+		_ = db.LogFollower(somebody)
+		require.NoFileExists(t, filepath.Join(dir, "followers.json"))
+
+		require.NoError(t, db.FlushFollowers())
+
+		reopened, err := twt.NewFileDB(dir)
+		require.NoError(t, err)
+		followers, _ := reopened.ListFollowers()
+
+		require.Len(t, followers, 1)
+		require.Equal(t, 1, followers[0].Fetches)
+	})
+
+	t.Run("migrates followers.log", func(t *testing.T) {
+		dir := t.TempDir()
+		log := "2022/01/01 10:00:00 " + somebody + "\n" +
+			"2022/01/02 11:00:00 " + somebody + "\n" +
+			"2022/01/03 12:00:00 " + pod + "\n" +
+			"not a log line\n"
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "followers.log"), []byte(log), 0600))
+
+		db, err := twt.NewFileDB(dir)
+		require.NoError(t, err)
+		followers, _ := db.ListFollowers()
+
+		require.Len(t, followers, 2)
+		require.Equal(t, 2, followers[0].Fetches)
+		require.Equal(t, time.Date(2022, 1, 1, 10, 0, 0, 0, time.Local), followers[0].FirstSeen)
+		require.Equal(t, time.Date(2022, 1, 2, 11, 0, 0, 0, time.Local), followers[0].LastSeen)
+		require.Equal(t, 1, followers[1].Fetches)
+		require.NoFileExists(t, filepath.Join(dir, "followers.log"))
+		require.FileExists(t, filepath.Join(dir, "followers.log.migrated"))
+		require.FileExists(t, filepath.Join(dir, "followers.json"))
+	})
+}
+
+func TestFileDBCachedFeeds(t *testing.T) {
+	feed := &twt.CachedFeed{
+		URL:       "https://example.com/twtxt.txt",
+		Nick:      "somebody",
+		ETag:      `"abc"`,
+		FetchedAt: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+		Content:   status,
+	}
+
+	t.Run("stores and persists cached feeds", func(t *testing.T) {
+		dir := t.TempDir()
+		db, _ := twt.NewFileDB(dir)
+		require.NoError(t, db.PutCachedFeed(feed))
+
+		reopened, err := twt.NewFileDB(dir)
+		require.NoError(t, err)
+		cached, err := reopened.GetCachedFeed(feed.URL)
+
+		require.NoError(t, err)
+		require.Equal(t, feed, cached)
+		feeds, _ := reopened.ListCachedFeeds()
+		require.Equal(t, []*twt.CachedFeed{feed}, feeds)
+	})
+
+	t.Run("returns nil for feeds that were never fetched", func(t *testing.T) {
+		db, _ := twt.NewFileDB(t.TempDir())
+
+		cached, err := db.GetCachedFeed(feed.URL)
+
+		require.NoError(t, err)
+		require.Nil(t, cached)
+	})
+
+	t.Run("drops feeds that were not fetched for a month", func(t *testing.T) {
+		dir := t.TempDir()
+		db, _ := twt.NewFileDB(dir)
+		require.NoError(t, db.PutCachedFeed(feed))
+		other := &twt.CachedFeed{URL: "https://other.example.com/twtxt.txt", FetchedAt: feed.FetchedAt.Add(31 * 24 * time.Hour), Content: status}
+
+		require.NoError(t, db.PutCachedFeed(other))
+
+		cached, _ := db.GetCachedFeed(feed.URL)
+		require.Nil(t, cached)
+		reopened, _ := twt.NewFileDB(dir)
+		feeds, _ := reopened.ListCachedFeeds()
+		require.Equal(t, []*twt.CachedFeed{other}, feeds)
+	})
+}
+
+func TestFileDBWebmentions(t *testing.T) {
+	first := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	mention := twt.Webmention{
+		Source:     "https://other.example.com/twtxt.txt",
+		Target:     "https://example.com/twtxt.txt",
+		ReceivedAt: first,
+		VerifiedAt: first,
+	}
+
+	t.Run("stores, updates and persists webmentions", func(t *testing.T) {
+		dir := t.TempDir()
+		db, _ := twt.NewFileDB(dir)
+		require.NoError(t, db.PutWebmention(mention))
+		updated := mention
+		updated.ReceivedAt = first.Add(time.Hour)
+		updated.VerifiedAt = first.Add(time.Hour)
+		require.NoError(t, db.PutWebmention(updated))
+
+		reopened, err := twt.NewFileDB(dir)
+		require.NoError(t, err)
+		mentions, _ := reopened.ListWebmentions()
+
+		require.Len(t, mentions, 1)
+		require.Equal(t, first, mentions[0].ReceivedAt)
+		require.Equal(t, first.Add(time.Hour), mentions[0].VerifiedAt)
+	})
+
+	t.Run("deletes webmentions", func(t *testing.T) {
+		db, _ := twt.NewFileDB(t.TempDir())
+		_ = db.PutWebmention(mention)
+
+		require.NoError(t, db.DeleteWebmention(mention.Source, mention.Target))
+
+		mentions, _ := db.ListWebmentions()
+		require.Empty(t, mentions)
+	})
+}
+
+func readTwtxt(t *testing.T, dir string) string {
+	content, err := os.ReadFile(filepath.Join(dir, "twtxt.txt"))
+	require.NoError(t, err)
+	return string(content)
+}
+
+func readDB(t *testing.T, db twt.DB) string {
+	file, err := db.Get()
+	require.NoError(t, err)
+	defer file.Close()
+	content, err := io.ReadAll(file)
+	require.NoError(t, err)
+	return string(content)
+}
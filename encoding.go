@@ -0,0 +1,51 @@
+package twt
+
+import (
+	"strconv"
+	"strings"
+)
+
+var contentEncodings = []string{"gzip"}
+
+// negotiateEncoding returns an empty string for the identity coding.
+func negotiateEncoding(acceptEncoding string) string {
+	for _, encoding := range contentEncodings {
+		if acceptsEncoding(acceptEncoding, encoding) {
+			return encoding
+		}
+	}
+	return ""
+}
+
+func acceptsEncoding(acceptEncoding string, encoding string) bool {
+	accepted := false
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding != encoding && coding != "*" {
+			continue
+		}
+		q := 1.0
+		if name, value, found := strings.Cut(strings.TrimSpace(params), "="); found && strings.TrimSpace(name) == "q" {
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if coding == encoding {
+			return q > 0
+		}
+		accepted = q > 0
+	}
+	return accepted
+}
+
+// encodedETag derives the entity tag of an encoded representation, which must
+// differ from the identity representation's.
+func encodedETag(etag string, encoding string) string {
+	if etag == "" {
+		return ""
+	}
+	return strings.TrimSuffix(etag, `"`) + "-" + encoding + `"`
+}
@@ -0,0 +1,121 @@
+package twt
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// maxFetchSize bounds how much of a remote document twtd reads.
+const maxFetchSize = 1 << 20
+
+var TooManyRedirectsErr = errors.New("too many redirects")
+
+// NewHTTPClient returns the client background tasks use to fetch remote
+// documents. Requests give up after timeout and follow at most five redirects.
+func NewHTTPClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return TooManyRedirectsErr
+			}
+			return nil
+		},
+	}
+}
+
+// NewPublicHTTPClient is like NewHTTPClient but refuses to connect to loopback,
+// private and link-local addresses, checked after resolving.
+func NewPublicHTTPClient(timeout time.Duration) *http.Client {
+	client := NewHTTPClient(timeout)
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second, Control: publicAddressOnly}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	client.Transport = transport
+	return client
+}
+
+type NonPublicAddressErr struct {
+	Address string
+}
+
+func (e *NonPublicAddressErr) Error() string {
+	return fmt.Sprintf("refusing to connect to non-public address %s", e.Address)
+}
+
+func publicAddressOnly(_ string, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return &NonPublicAddressErr{Address: address}
+	}
+	return nil
+}
+
+type UnexpectedStatusErr struct {
+	URL        string
+	StatusCode int
+}
+
+func (e *UnexpectedStatusErr) Error() string {
+	return fmt.Sprintf("fetching %s: unexpected status %d", e.URL, e.StatusCode)
+}
+
+// fetch GETs rawURL, reading at most maxFetchSize bytes of a successful response.
+func fetch(ctx context.Context, client *http.Client, userAgent string, rawURL string, header http.Header) (*http.Response, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("User-Agent", userAgent)
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotModified {
+		return res, nil, nil
+	}
+	if res.StatusCode != http.StatusOK {
+		return res, nil, &UnexpectedStatusErr{URL: rawURL, StatusCode: res.StatusCode}
+	}
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxFetchSize))
+	return res, body, err
+}
+
+// post POSTs body to rawURL and expects a 2xx response.
+func post(ctx context.Context, client *http.Client, userAgent string, rawURL string, contentType string, body []byte, header http.Header) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, rawURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("User-Agent", userAgent)
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	_ = res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return &UnexpectedStatusErr{URL: rawURL, StatusCode: res.StatusCode}
+	}
+	return nil
+}
@@ -4,65 +4,166 @@ import (
 	"fmt"
 	"net/url"
 	"regexp"
+	"strconv"
+	"strings"
 )
 
 type Follower interface {
 	String() string
 }
 
+// SingleFollower is a single feed following us, announced by a client as
+// "client/1.0 (+https://example.com/twtxt.txt; @nick)". Via is the list the
+// follower was found on, if it did not announce itself.
 type SingleFollower struct {
 	Nick string
 	URL  *url.URL
+	Via  *url.URL
 }
 
 func (f *SingleFollower) String() string {
 	return fmt.Sprintf("follower\t%s\t%s", f.Nick, f.URL.String())
 }
 
+// MultiFollower is a pod fetching on behalf of several of its users, announced
+// as "yarnd/1.0 (~https://pod.example.com/whoFollows?token=abc; contact=https://pod.example.com/support)".
+// ListURL lists the individual followers. Count is the number of followers the
+// pod claims, or zero when it does not say.
 type MultiFollower struct {
 	ListURL    *url.URL
 	ContactURL *url.URL
+	Count      int
 }
 
 func (f *MultiFollower) String() string {
 	return fmt.Sprintf("list\t%s\t%s", f.ListURL.String(), f.ContactURL.String())
 }
 
-var singleFollowerRegex = regexp.MustCompile("^[^\\/]+\\/[^\\(]+ \\(+([^;]+); @([^\\(]+)\\)$")
-var multiFollowerRegex = regexp.MustCompile("^[^\\/]+\\/[^\\(]+ \\(~([^;]+); contact=([^\\(]+)\\)$")
+// PodFollower is a pod that only identifies itself, announced by older yarnd
+// versions as "yarnd/0.2.0 (Pod: twtxt.net Support: https://twtxt.net/support)".
+type PodFollower struct {
+	Pod        string
+	SupportURL *url.URL
+}
+
+func (f *PodFollower) String() string {
+	return fmt.Sprintf("pod\t%s\t%s", f.Pod, f.SupportURL.String())
+}
 
 func FollowerUserAgent(userAgent string) bool {
-	return singleFollowerRegex.MatchString(userAgent) || multiFollowerRegex.MatchString(userAgent)
+	return len(ParseFollowers(userAgent)) > 0
 }
 
+// ParseFollower returns the first follower announced by userAgent, or nil.
 func ParseFollower(userAgent string) Follower {
-	matches := singleFollowerRegex.FindStringSubmatch(userAgent)
-	if len(matches) == 3 {
-		u, err := url.Parse(matches[1])
-		if err != nil {
-			return nil
+	followers := ParseFollowers(userAgent)
+	if len(followers) == 0 {
+		return nil
+	}
+	return followers[0]
+}
+
+// ParseFollowers returns every follower announced in the comments of
+// userAgent. Within a comment, ";" separates tokens: "+url" and "@nick" pair up
+// into a SingleFollower, "~url" with "contact=url" forms a MultiFollower,
+// "via=url" attributes the comment's followers to a list, and tokens that mean
+// nothing to twtxt are skipped.
+func ParseFollowers(userAgent string) []Follower {
+	var followers []Follower
+	for _, comment := range userAgentComments(userAgent) {
+		followers = append(followers, parseComment(comment)...)
+	}
+	return followers
+}
+
+func userAgentComments(userAgent string) []string {
+	var comments []string
+	depth, start := 0, 0
+	for i, r := range userAgent {
+		switch r {
+		case '(':
+			if depth == 0 {
+				start = i + 1
+			}
+			depth++
+		case ')':
+			if depth == 0 {
+				continue
+			}
+			depth--
+			if depth == 0 {
+				comments = append(comments, userAgent[start:i])
+			}
 		}
-		return &SingleFollower{
-			Nick: matches[2],
-			URL:  u,
+	}
+	return comments
+}
+
+var podCommentRegex = regexp.MustCompile(`^Pod:\s*(\S+)\s+Support:\s*(\S+)$`)
+var followerCountRegex = regexp.MustCompile(`^followers\s*[:=]\s*(\d+)$`)
+var nickRegex = regexp.MustCompile(`^[^\s@;()<>]+$`)
+
+func parseComment(comment string) []Follower {
+	if matches := podCommentRegex.FindStringSubmatch(strings.TrimSpace(comment)); matches != nil {
+		if supportURL, ok := parseFollowerURL(matches[2]); ok {
+			return []Follower{&PodFollower{Pod: matches[1], SupportURL: supportURL}}
 		}
+		return nil
 	}
 
-	matches = multiFollowerRegex.FindStringSubmatch(userAgent)
-	if len(matches) == 3 {
-		listURL, err := url.Parse(matches[1])
-		if err != nil {
-			return nil
+	var followers []Follower
+	var feedURL, listURL, contactURL, viaURL *url.URL
+	var nick string
+	count := 0
+	for _, token := range strings.Split(comment, ";") {
+		token = strings.TrimSpace(token)
+		switch {
+		case strings.HasPrefix(token, "+"):
+			if u, ok := parseFollowerURL(token[1:]); ok {
+				feedURL = u
+			}
+		case strings.HasPrefix(token, "@"):
+			if nickRegex.MatchString(token[1:]) {
+				nick = token[1:]
+			}
+		case strings.HasPrefix(token, "~"):
+			if u, ok := parseFollowerURL(token[1:]); ok {
+				listURL = u
+			}
+		case strings.HasPrefix(token, "contact="):
+			if u, ok := parseFollowerURL(strings.TrimPrefix(token, "contact=")); ok {
+				contactURL = u
+			}
+		case strings.HasPrefix(token, "via="):
+			if u, ok := parseFollowerURL(strings.TrimPrefix(token, "via=")); ok {
+				viaURL = u
+			}
+		case followerCountRegex.MatchString(token):
+			count, _ = strconv.Atoi(followerCountRegex.FindStringSubmatch(token)[1])
 		}
-		contactURL, err := url.Parse(matches[2])
-		if err != nil {
-			return nil
+		if feedURL != nil && nick != "" {
+			followers = append(followers, &SingleFollower{Nick: nick, URL: feedURL})
+			feedURL, nick = nil, ""
 		}
-		return &MultiFollower{
-			ListURL:    listURL,
-			ContactURL: contactURL,
+	}
+	if viaURL != nil {
+		for _, f := range followers {
+			f.(*SingleFollower).Via = viaURL
 		}
 	}
+	if listURL != nil && contactURL != nil {
+		if count == 0 {
+			count, _ = strconv.Atoi(listURL.Query().Get("followers"))
+		}
+		followers = append(followers, &MultiFollower{ListURL: listURL, ContactURL: contactURL, Count: count})
+	}
+	return followers
+}
 
-	return nil
+func parseFollowerURL(rawURL string) (*url.URL, bool) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, false
+	}
+	return u, true
 }
@@ -0,0 +1,97 @@
+package twt_test
+
+import (
+	"github.com/m25n/twt"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestParseFollowers(t *testing.T) {
+	for _, tc := range []struct {
+		userAgent string
+		followers []string
+	}{
+		{
+			userAgent: "twtxt/1.2.3 (+https://example.com/twtxt.txt; @somebody)",
+			followers: []string{"follower\tsomebody\thttps://example.com/twtxt.txt"},
+		},
+		{
+			userAgent: "yarnd/0.14.0@0f7d5ab (+https://twtxt.net/user/prologic/twtxt.txt; @prologic)",
+			followers: []string{"follower\tprologic\thttps://twtxt.net/user/prologic/twtxt.txt"},
+		},
+		{
+			userAgent: "jenny/latest (+https://uninformativ.de/twtxt.txt; @movq)",
+			followers: []string{"follower\tmovq\thttps://uninformativ.de/twtxt.txt"},
+		},
+		{
+			userAgent: "twtxt-go/0.1.0 (@alice; +https://example.org/twtxt.txt)",
+			followers: []string{"follower\talice\thttps://example.org/twtxt.txt"},
+		},
+		{
+			userAgent: "Mozilla/5.0 (compatible; twtxt-php/1.0; +https://example.net/twtxt.txt; @carol)",
+			followers: []string{"follower\tcarol\thttps://example.net/twtxt.txt"},
+		},
+		{
+			userAgent: "twtxt/1.2.3 (+https://a.example.com/twtxt.txt; @alice) (+https://b.example.com/twtxt.txt; @bob)",
+			followers: []string{
+				"follower\talice\thttps://a.example.com/twtxt.txt",
+				"follower\tbob\thttps://b.example.com/twtxt.txt",
+			},
+		},
+		{
+			userAgent: "tt/1.0 (+https://a.example.com/twtxt.txt; @alice; +https://b.example.com/twtxt.txt; @bob; followers: 2)",
+			followers: []string{
+				"follower\talice\thttps://a.example.com/twtxt.txt",
+				"follower\tbob\thttps://b.example.com/twtxt.txt",
+			},
+		},
+		{
+			userAgent: "yarnd/0.13.0@4d7ffc3 (~https://twtxt.net/whoFollows?followers=14&token=w3lRE1ZG; contact=https://twtxt.net/support)",
+			followers: []string{"list\thttps://twtxt.net/whoFollows?followers=14&token=w3lRE1ZG\thttps://twtxt.net/support"},
+		},
+		{
+			userAgent: "twtxt/1.2.3 (~https://pod.example.com/whoFollows?token=abc; contact=https://pod.example.com/support)",
+			followers: []string{"list\thttps://pod.example.com/whoFollows?token=abc\thttps://pod.example.com/support"},
+		},
+		{
+			userAgent: "yarnd/0.2.0@46bbb5b (Pod: twtxt.net Support: https://twtxt.net/support)",
+			followers: []string{"pod\ttwtxt.net\thttps://twtxt.net/support"},
+		},
+		{userAgent: "curl/7.79.1"},
+		{userAgent: "Mozilla/5.0 (X11; Linux x86_64; rv:105.0) Gecko/20100101 Firefox/105.0"},
+		{userAgent: "twtxt/1.2.3 (+https://example.com/twtxt.txt)"},
+		{userAgent: "twtxt/1.2.3 (+notaurl; @somebody)"},
+		{userAgent: "twtxt/1.2.3 (+ftp://example.com/twtxt.txt; @somebody)"},
+		{userAgent: "yarnd/0.13.0 (~https://twtxt.net/whoFollows?token=abc)"},
+		{userAgent: ""},
+	} {
+		t.Run(tc.userAgent, func(t *testing.T) {
+			var followers []string
+			for _, f := range twt.ParseFollowers(tc.userAgent) {
+				followers = append(followers, f.String())
+			}
+
+			require.Equal(t, tc.followers, followers)
+			require.Equal(t, len(tc.followers) > 0, twt.FollowerUserAgent(tc.userAgent))
+		})
+	}
+}
+
+func TestParseFollower(t *testing.T) {
+	t.Run("reads the follower count of a list", func(t *testing.T) {
+		for userAgent, count := range map[string]int{
+			"yarnd/0.13.0 (~https://twtxt.net/whoFollows?followers=14&token=abc; contact=https://twtxt.net/support)":  14,
+			"yarnd/0.13.0 (~https://twtxt.net/whoFollows?token=abc; contact=https://twtxt.net/support; followers: 3)": 3,
+			"yarnd/0.13.0 (~https://twtxt.net/whoFollows?token=abc; contact=https://twtxt.net/support)":               0,
+		} {
+			follower, ok := twt.ParseFollower(userAgent).(*twt.MultiFollower)
+
+			require.True(t, ok)
+			require.Equal(t, count, follower.Count)
+		}
+	})
+
+	t.Run("returns nil for other user agents", func(t *testing.T) {
+		require.Nil(t, twt.ParseFollower("curl/7.79.1"))
+	})
+}
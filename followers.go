@@ -0,0 +1,164 @@
+package twt
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// FollowerRecord is what twtd remembers about a follower, keyed by its nick
+// and URL. For a MultiFollower the URL is the list URL it announced last and
+// Count the number of followers it claimed, for a PodFollower the nick is the
+// pod name and the URL its support URL.
+type FollowerRecord struct {
+	Kind       string    `json:"kind,omitempty"`
+	Nick       string    `json:"nick,omitempty"`
+	URL        string    `json:"url"`
+	ContactURL string    `json:"contact_url,omitempty"`
+	Count      int       `json:"count,omitempty"`
+	Via        string    `json:"via,omitempty"`
+	FirstSeen  time.Time `json:"first_seen"`
+	LastSeen   time.Time `json:"last_seen"`
+	Fetches    int       `json:"fetches"`
+	UserAgent  string    `json:"user_agent"`
+	// Verification is Verified or Unverified once a FollowerVerifier has
+	// checked the follower, at VerifiedAt.
+	Verification string     `json:"verification,omitempty"`
+	VerifiedAt   *time.Time `json:"verified_at,omitempty"`
+}
+
+const (
+	followerKind = "follower"
+	listKind     = "list"
+	podKind      = "pod"
+)
+
+func newFollowerRecord(follower Follower) *FollowerRecord {
+	switch f := follower.(type) {
+	case *SingleFollower:
+		r := &FollowerRecord{Kind: followerKind, Nick: f.Nick, URL: f.URL.String()}
+		if f.Via != nil {
+			r.Via = f.Via.String()
+		}
+		return r
+	case *MultiFollower:
+		return &FollowerRecord{Kind: listKind, URL: f.ListURL.String(), ContactURL: f.ContactURL.String(), Count: f.Count}
+	case *PodFollower:
+		return &FollowerRecord{Kind: podKind, Nick: f.Pod, URL: f.SupportURL.String()}
+	default:
+		return &FollowerRecord{URL: follower.String()}
+	}
+}
+
+func (r *FollowerRecord) key() string {
+	if r.Kind == listKind {
+		return r.Nick + " " + stableListURL(r.URL)
+	}
+	return r.Nick + " " + r.URL
+}
+
+// volatileListParams change while a list stays the same: yarnd rotates its
+// token and announces its follower count.
+var volatileListParams = []string{"token", "followers"}
+
+func stableListURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	query := u.Query()
+	for _, param := range volatileListParams {
+		query.Del(param)
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// Follower turns a record back into the follower it was recorded for.
+func (r FollowerRecord) Follower() Follower {
+	u, err := url.Parse(r.URL)
+	if err != nil {
+		return nil
+	}
+	switch r.Kind {
+	case listKind:
+		contactURL, err := url.Parse(r.ContactURL)
+		if err != nil {
+			return nil
+		}
+		return &MultiFollower{ListURL: u, ContactURL: contactURL}
+	case podKind:
+		return &PodFollower{Pod: r.Nick, SupportURL: u}
+	default:
+		return &SingleFollower{Nick: r.Nick, URL: u}
+	}
+}
+
+func getFollowersHandler(logger Logger, db DB, now func() time.Time) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		since, ok := parseSince(req.URL.Query().Get("since"), now())
+		if !ok {
+			http.Error(res, "invalid since parameter", http.StatusBadRequest)
+			return
+		}
+		records, err := db.ListFollowers()
+		if err != nil {
+			logger.GettingFollowersErr(err)
+			res.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		followers := make([]FollowerRecord, 0, len(records))
+		for _, r := range records {
+			if !r.LastSeen.Before(since) {
+				followers = append(followers, r)
+			}
+		}
+		if !prefersText(req.Header.Get("Accept")) {
+			writeJSON(logger, res, http.StatusOK, followers)
+			return
+		}
+		buf := bytes.NewBuffer(nil)
+		for _, r := range followers {
+			if f := r.Follower(); f != nil {
+				buf.WriteString(f.String() + "\n")
+			}
+		}
+		res.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if _, err := io.Copy(res, buf); err != nil {
+			logger.WritingBodyErr(err)
+		}
+	}
+}
+
+func parseSince(since string, now time.Time) (time.Time, bool) {
+	if since == "" {
+		return time.Time{}, true
+	}
+	if d, err := time.ParseDuration(since); err == nil && d >= 0 {
+		return now.Add(-d), true
+	}
+	if t, err := time.Parse(time.RFC3339, since); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+func prefersText(accept string) bool {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case "application/json":
+			return false
+		case "text/plain", "text/vnd.twtxt+plain", "text/vnd.twtxt":
+			return true
+		}
+	}
+	return false
+}
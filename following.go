@@ -0,0 +1,138 @@
+package twt
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/m25n/twt/twtxt"
+	"net/http"
+	"strings"
+)
+
+// Following is a feed we follow, mirrored into "# follow = nick url" metadata.
+type Following struct {
+	Nick string `json:"nick"`
+	URL  string `json:"url"`
+}
+
+func (f Following) metadata() string {
+	if f.Nick == "" {
+		return f.URL
+	}
+	return f.Nick + " " + f.URL
+}
+
+func (f Following) validate() error {
+	if f.Nick != "" && !nickRegex.MatchString(f.Nick) {
+		return errors.New("invalid nick")
+	}
+	if _, ok := parseFollowerURL(f.URL); !ok {
+		return errors.New("invalid url")
+	}
+	return nil
+}
+
+// parseFollowing reads "# follow =" metadata of either "nick url" or a bare URL.
+func parseFollowing(feed *twtxt.Feed) []Following {
+	var following []Following
+	for _, follow := range feed.Metadata("follow") {
+		fields := strings.Fields(follow)
+		switch len(fields) {
+		case 1:
+			following = append(following, Following{URL: fields[0]})
+		case 2:
+			following = append(following, Following{Nick: fields[0], URL: fields[1]})
+		}
+	}
+	return following
+}
+
+func setFollowing(feed *twtxt.Feed, following []Following) {
+	values := make([]string, 0, len(following))
+	for _, f := range following {
+		values = append(values, f.metadata())
+	}
+	feed.SetMetadata("follow", values...)
+}
+
+func getFollowingHandler(logger Logger, db DB) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		feed, err := getFeed(db)
+		if err != nil {
+			logger.GettingTwtxtErr(err)
+			res.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		following := parseFollowing(feed)
+		if following == nil {
+			following = []Following{}
+		}
+		writeJSON(logger, res, http.StatusOK, following)
+	}
+}
+
+func postFollowingHandler(logger Logger, db DB) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		var follow Following
+		if err := json.NewDecoder(req.Body).Decode(&follow); err != nil {
+			http.Error(res, "invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		if err := follow.validate(); err != nil {
+			http.Error(res, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var following []Following
+		err := db.Rewrite(func(feed *twtxt.Feed) error {
+			following = parseFollowing(feed)
+			replaced := false
+			for i, f := range following {
+				if f.URL == follow.URL {
+					following[i] = follow
+					replaced = true
+				}
+			}
+			if !replaced {
+				following = append(following, follow)
+			}
+			setFollowing(feed, following)
+			return nil
+		})
+		if err != nil {
+			logger.RewritingTwtxtErr(err)
+			res.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		writeJSON(logger, res, http.StatusOK, following)
+	}
+}
+
+var NotFollowingErr = errors.New("not following")
+
+func deleteFollowingHandler(logger Logger, db DB) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		url := req.URL.Query().Get("url")
+		err := db.Rewrite(func(feed *twtxt.Feed) error {
+			following := parseFollowing(feed)
+			remaining := make([]Following, 0, len(following))
+			for _, f := range following {
+				if f.URL != url {
+					remaining = append(remaining, f)
+				}
+			}
+			if len(remaining) == len(following) {
+				return NotFollowingErr
+			}
+			setFollowing(feed, remaining)
+			return nil
+		})
+		switch {
+		case err == nil:
+			res.WriteHeader(http.StatusNoContent)
+		case errors.Is(err, NotFollowingErr):
+			http.NotFound(res, req)
+		default:
+			logger.RewritingTwtxtErr(err)
+			res.WriteHeader(http.StatusInternalServerError)
+		}
+	}
+}
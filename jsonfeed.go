@@ -0,0 +1,145 @@
+package twt
+
+import (
+	"encoding/json"
+	"github.com/m25n/twt/twtxt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+)
+
+type jsonFeed struct {
+	Version     string           `json:"version"`
+	Title       string           `json:"title"`
+	HomePageURL string           `json:"home_page_url,omitempty"`
+	FeedURL     string           `json:"feed_url,omitempty"`
+	Description string           `json:"description,omitempty"`
+	Icon        string           `json:"icon,omitempty"`
+	Authors     []jsonFeedAuthor `json:"authors"`
+	Items       []jsonFeedItem   `json:"items"`
+}
+
+type jsonFeedAuthor struct {
+	Name   string `json:"name"`
+	URL    string `json:"url,omitempty"`
+	Avatar string `json:"avatar,omitempty"`
+}
+
+type jsonFeedItem struct {
+	ID            string        `json:"id"`
+	URL           string        `json:"url,omitempty"`
+	ContentText   string        `json:"content_text"`
+	DatePublished string        `json:"date_published"`
+	Tags          []string      `json:"tags,omitempty"`
+	Twtxt         jsonFeedTwtxt `json:"_twtxt"`
+}
+
+type jsonFeedTwtxt struct {
+	Hash     string       `json:"hash"`
+	Text     string       `json:"text"`
+	Mentions []apiMention `json:"mentions"`
+}
+
+func renderJSONFeed(v *feedView) ([]byte, error) {
+	feed := jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       v.Title(),
+		HomePageURL: siteURL(v.URL, "./"),
+		FeedURL:     siteURL(v.URL, "feed.json"),
+		Description: v.Description,
+		Icon:        v.Avatar,
+		Authors:     []jsonFeedAuthor{{Name: v.Title(), URL: v.URL, Avatar: v.Avatar}},
+		Items:       []jsonFeedItem{},
+	}
+	for _, t := range v.Twts {
+		feed.Items = append(feed.Items, jsonFeedItem{
+			ID:            entryID(v, t),
+			URL:           t.Permalink,
+			ContentText:   plainText(t.Text),
+			DatePublished: t.Created.Format(time.RFC3339),
+			Tags:          t.Hashtags,
+			Twtxt:         jsonFeedTwtxt{Hash: t.Hash, Text: t.Text, Mentions: apiMentions(t.Mentions)},
+		})
+	}
+	return json.MarshalIndent(feed, "", "  ")
+}
+
+type apiTwt struct {
+	Hash     string       `json:"hash"`
+	URL      string       `json:"url,omitempty"`
+	Created  time.Time    `json:"created"`
+	Text     string       `json:"text"`
+	Mentions []apiMention `json:"mentions"`
+	Hashtags []string     `json:"hashtags"`
+	Subject  string       `json:"subject,omitempty"`
+}
+
+type apiMention struct {
+	Nick string `json:"nick,omitempty"`
+	URL  string `json:"url"`
+}
+
+type apiTwts struct {
+	Twts []apiTwt `json:"twts"`
+	Next string   `json:"next,omitempty"`
+}
+
+func apiMentions(mentions []twtxt.Mention) []apiMention {
+	converted := make([]apiMention, 0, len(mentions))
+	for _, m := range mentions {
+		converted = append(converted, apiMention{Nick: m.Nick, URL: m.URL})
+	}
+	return converted
+}
+
+// getAPITwtsHandler pages through our twts oldest first, never splitting twts
+// that share a timestamp across pages.
+func getAPITwtsHandler(logger Logger, db DB, fallbackURL string, now func() time.Time) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		limit, ok := parseLimit(req.URL.Query().Get("limit"), 50)
+		if !ok {
+			http.Error(res, "invalid limit parameter", http.StatusBadRequest)
+			return
+		}
+		since, ok := parseSince(req.URL.Query().Get("since"), now())
+		if !ok {
+			http.Error(res, "invalid since parameter", http.StatusBadRequest)
+			return
+		}
+		renderHandler(logger, db, fallbackURL, "application/json", "", func(v *feedView) ([]byte, error) {
+			var twts []twtView
+			for i := len(v.Twts) - 1; i >= 0; i-- {
+				if v.Twts[i].Created.After(since) {
+					twts = append(twts, v.Twts[i])
+				}
+			}
+			sort.SliceStable(twts, func(i, j int) bool {
+				return twts[i].Created.Before(twts[j].Created)
+			})
+			page := apiTwts{Twts: []apiTwt{}}
+			for i, t := range twts {
+				if i >= limit && !t.Created.Equal(twts[i-1].Created) {
+					page.Next = nextPage(req.URL, twts[i-1].Created, limit)
+					break
+				}
+				page.Twts = append(page.Twts, apiTwt{
+					Hash:     t.Hash,
+					URL:      t.Permalink,
+					Created:  t.Created,
+					Text:     t.Text,
+					Mentions: apiMentions(t.Mentions),
+					Hashtags: append([]string{}, t.Hashtags...),
+					Subject:  t.Subject,
+				})
+			}
+			return json.MarshalIndent(page, "", "  ")
+		})(res, req)
+	}
+}
+
+func nextPage(u *url.URL, since time.Time, limit int) string {
+	query := url.Values{"since": {since.Format(time.RFC3339Nano)}, "limit": {strconv.Itoa(limit)}}
+	return (&url.URL{Path: u.Path, RawQuery: query.Encode()}).String()
+}
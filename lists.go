@@ -0,0 +1,104 @@
+package twt
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/m25n/twt/task"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// ListFetcher records the followers on the lists of pods following us.
+type ListFetcher struct {
+	logger      Logger
+	db          DB
+	enqueueTask task.EnqueueFunc
+	client      *http.Client
+	userAgent   string
+}
+
+func NewListFetcher(logger Logger, db DB, enqueueTask task.EnqueueFunc, client *http.Client, userAgent string) *ListFetcher {
+	return &ListFetcher{logger: logger, db: db, enqueueTask: enqueueTask, client: client, userAgent: userAgent}
+}
+
+// FetchAll enqueues a task per MultiFollower in the registry that fetches its
+// list.
+func (l *ListFetcher) FetchAll(ctx context.Context) {
+	records, err := l.db.ListFollowers()
+	if err != nil {
+		l.logger.GettingFollowersErr(err)
+		return
+	}
+	for _, r := range records {
+		list, ok := r.Follower().(*MultiFollower)
+		if !ok {
+			continue
+		}
+		err := l.enqueueTask(ctx, func(ctx context.Context) {
+			if err := l.Fetch(ctx, list); err != nil {
+				l.logger.FetchingFollowerListErr(err)
+			}
+		})
+		if err != nil {
+			l.logger.FetchingFollowerListErr(err)
+			return
+		}
+	}
+}
+
+// Fetch records every follower on list through DB.LogListFollowers.
+func (l *ListFetcher) Fetch(ctx context.Context, list *MultiFollower) error {
+	res, body, err := fetch(ctx, l.client, l.userAgent, list.ListURL.String(), http.Header{
+		"Accept": {"application/json, text/plain;q=0.9"},
+	})
+	if err != nil {
+		return err
+	}
+	mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	return l.db.LogListFollowers(list, parseFollowerList(mediaType, body))
+}
+
+func parseFollowerList(mediaType string, body []byte) []*SingleFollower {
+	if mediaType == "application/json" {
+		var nicks map[string]string
+		if err := json.Unmarshal(body, &nicks); err != nil {
+			return nil
+		}
+		followers := make([]*SingleFollower, 0, len(nicks))
+		for nick, rawURL := range nicks {
+			if f := newListFollower(nick, rawURL); f != nil {
+				followers = append(followers, f)
+			}
+		}
+		sort.Slice(followers, func(i, j int) bool {
+			return followers[i].Nick < followers[j].Nick
+		})
+		return followers
+	}
+	var followers []*SingleFollower
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		line = strings.TrimSuffix(strings.TrimPrefix(line, "@<"), ">")
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		if f := newListFollower(fields[0], fields[1]); f != nil {
+			followers = append(followers, f)
+		}
+	}
+	return followers
+}
+
+func newListFollower(nick string, rawURL string) *SingleFollower {
+	u, ok := parseFollowerURL(rawURL)
+	if !ok || !nickRegex.MatchString(nick) {
+		return nil
+	}
+	return &SingleFollower{Nick: nick, URL: u}
+}
@@ -0,0 +1,103 @@
+package twt_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/m25n/twt"
+	"github.com/m25n/twt/task"
+	"github.com/m25n/twt/testhelper"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestListFetcher(t *testing.T) {
+	newList := func(t *testing.T, contentType string, body string) *twt.MultiFollower {
+		remote := testhelper.NewServer(t, http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			require.Equal(t, "twtd/test", req.Header.Get("User-Agent"))
+			res.Header().Set("Content-Type", contentType)
+			_, _ = fmt.Fprint(res, body)
+		}))
+		listURL, _ := url.Parse(remote + "/whoFollows?token=abc")
+		contactURL, _ := url.Parse(remote + "/support")
+		return &twt.MultiFollower{ListURL: listURL, ContactURL: contactURL}
+	}
+
+	t.Run("records followers from a json list", func(t *testing.T) {
+		list := newList(t, "application/json", `{"bob":"https://b.example.com/twtxt.txt","alice":"https://a.example.com/twtxt.txt","eve":"not a url"}`)
+		db := testhelper.NewMockDB()
+		fetcher := twt.NewListFetcher(testhelper.DummyLogger{}, db, testhelper.SyncEnqueueTask, twt.NewHTTPClient(time.Second), "twtd/test")
+
+		err := fetcher.Fetch(context.Background(), list)
+
+		require.NoError(t, err)
+		followers := db.ListedFollowers[list.ListURL.String()]
+		require.Len(t, followers, 2)
+		require.Equal(t, "alice", followers[0].Nick)
+		require.Equal(t, "https://a.example.com/twtxt.txt", followers[0].URL.String())
+	})
+
+	t.Run("records followers from a text list", func(t *testing.T) {
+		list := newList(t, "text/plain", "alice https://a.example.com/twtxt.txt\n@<bob https://b.example.com/twtxt.txt>\ngarbage\n")
+		db := testhelper.NewMockDB()
+		fetcher := twt.NewListFetcher(testhelper.DummyLogger{}, db, testhelper.SyncEnqueueTask, twt.NewHTTPClient(time.Second), "twtd/test")
+
+		_ = fetcher.Fetch(context.Background(), list)
+
+		followers := db.ListedFollowers[list.ListURL.String()]
+		require.Len(t, followers, 2)
+		require.Equal(t, "bob", followers[1].Nick)
+	})
+
+	t.Run("fetches the lists of every pod in the registry", func(t *testing.T) {
+		list := newList(t, "application/json", `{"alice":"https://a.example.com/twtxt.txt"}`)
+		db, err := twt.NewFileDB(t.TempDir())
+		require.NoError(t, err)
+		require.NoError(t, db.LogFollower(fmt.Sprintf("yarnd/0.13.0 (~%s; contact=%s)", list.ListURL, list.ContactURL)))
+		fetcher := twt.NewListFetcher(testhelper.DummyLogger{}, db, testhelper.SyncEnqueueTask, twt.NewHTTPClient(time.Second), "twtd/test")
+
+		fetcher.FetchAll(context.Background())
+
+		followers, _ := db.ListFollowers()
+		require.Len(t, followers, 2)
+		require.Equal(t, "alice", followers[1].Nick)
+		require.Equal(t, list.ListURL.String(), followers[1].Via)
+	})
+
+	t.Run("fetches each list in its own task", func(t *testing.T) {
+		db := testhelper.NewMockDB()
+		db.FollowerRecords = []twt.FollowerRecord{
+			{Kind: "list", URL: "https://a.example.com/whoFollows", ContactURL: "https://a.example.com/support"},
+			{Nick: "somebody", URL: "https://example.com/twtxt.txt"},
+			{Kind: "list", URL: "https://b.example.com/whoFollows", ContactURL: "https://b.example.com/support"},
+		}
+		var enqueued int
+		enqueue := func(_ context.Context, _ task.Task) error {
+			enqueued++
+			return nil
+		}
+		fetcher := twt.NewListFetcher(testhelper.DummyLogger{}, db, enqueue, twt.NewHTTPClient(time.Second), "twtd/test")
+
+		fetcher.FetchAll(context.Background())
+
+		require.Equal(t, 2, enqueued)
+	})
+
+	t.Run("logs errors fetching lists", func(t *testing.T) {
+		remote := testhelper.NewServer(t, http.NotFoundHandler())
+		logger := testhelper.NewMockLogger()
+		db := testhelper.NewMockDB()
+		db.FollowerRecords = []twt.FollowerRecord{{Kind: "list", URL: remote + "/whoFollows", ContactURL: remote + "/support"}}
+		fetcher := twt.NewListFetcher(logger, db, testhelper.SyncEnqueueTask, twt.NewHTTPClient(time.Second), "twtd/test")
+
+		fetcher.FetchAll(context.Background())
+
+		require.Len(t, logger.FetchingFollowerListErrs, 1)
+		var statusErr *twt.UnexpectedStatusErr
+		require.ErrorAs(t, logger.FetchingFollowerListErrs[0], &statusErr)
+		require.Equal(t, http.StatusNotFound, statusErr.StatusCode)
+		require.Empty(t, db.ListedFollowers)
+	})
+}
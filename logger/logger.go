@@ -20,10 +20,54 @@ func (l *Logger) GettingTwtxtErr(err error) {
 	l.logger().Println("error getting twtxt.txt", err)
 }
 
+func (l *Logger) GettingFollowersErr(err error) {
+	l.logger().Println("error getting followers:", err.Error())
+}
+
 func (l *Logger) FollowerLoggingErr(err error) {
 	l.logger().Println("error logging follower:", err.Error())
 }
 
+func (l *Logger) FetchingFollowerListErr(err error) {
+	l.logger().Println("error fetching follower list:", err.Error())
+}
+
+func (l *Logger) VerifyingFollowerErr(err error) {
+	l.logger().Println("error verifying follower:", err.Error())
+}
+
+func (l *Logger) FetchingFeedErr(err error) {
+	l.logger().Println("error fetching feed:", err.Error())
+}
+
+func (l *Logger) VerifyingWebmentionErr(err error) {
+	l.logger().Println("error verifying webmention:", err.Error())
+}
+
+func (l *Logger) SendingWebmentionErr(err error) {
+	l.logger().Println("error sending webmention:", err.Error())
+}
+
+func (l *Logger) VerifyingSubscriptionErr(err error) {
+	l.logger().Println("error verifying subscription:", err.Error())
+}
+
+func (l *Logger) PublishingFeedErr(err error) {
+	l.logger().Println("error publishing feed:", err.Error())
+}
+
+func (l *Logger) VerifyingAccessTokenErr(err error) {
+	l.logger().Println("error verifying access token:", err.Error())
+}
+
 func (l *Logger) PostingStatusErr(err error) {
 	l.logger().Println("error posting status:", err.Error())
 }
+
+func (l *Logger) RewritingTwtxtErr(err error) {
+	l.logger().Println("error rewriting twtxt.txt:", err.Error())
+}
+
+func (l *Logger) ArchivingErr(err error) {
+	l.logger().Println("error archiving twts:", err.Error())
+}
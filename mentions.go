@@ -0,0 +1,100 @@
+package twt
+
+import (
+	"context"
+	"github.com/m25n/twt/twtxt"
+	"net/http"
+	"sort"
+	"time"
+)
+
+const (
+	recentFollowerAge = 24 * time.Hour
+	maxFollowerFeeds  = 200
+)
+
+// FetchFollowers enqueues a task per verified or recently seen follower that
+// fetches its feed for mentions.
+func (f *FeedFetcher) FetchFollowers(ctx context.Context) {
+	records, err := f.db.ListFollowers()
+	if err != nil {
+		f.logger.GettingFollowersErr(err)
+		return
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].LastSeen.After(records[j].LastSeen)
+	})
+	fetched := 0
+	for _, r := range records {
+		follower, ok := r.Follower().(*SingleFollower)
+		if !ok || (r.Verification != Verified && f.now().Sub(r.LastSeen) > recentFollowerAge) {
+			continue
+		}
+		if fetched == maxFollowerFeeds {
+			return
+		}
+		fetched++
+		if err := f.enqueueFetch(ctx, follower.Nick, follower.URL.String()); err != nil {
+			f.logger.FetchingFeedErr(err)
+			return
+		}
+	}
+}
+
+func mentionsOf(t twtxt.Twt, urls map[string]bool) bool {
+	for _, m := range t.Mentions {
+		if urls[m.URL] {
+			return true
+		}
+	}
+	return false
+}
+
+func getMentionsHandler(logger Logger, db DB, fallbackURL string, now func() time.Time) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		limit, ok := parseLimit(req.URL.Query().Get("limit"), 50)
+		if !ok {
+			http.Error(res, "invalid limit parameter", http.StatusBadRequest)
+			return
+		}
+		since, ok := parseSince(req.URL.Query().Get("since"), now())
+		if !ok {
+			http.Error(res, "invalid since parameter", http.StatusBadRequest)
+			return
+		}
+		feed, err := getFeed(db)
+		if err != nil {
+			logger.GettingTwtxtErr(err)
+			res.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		ours := map[string]bool{feedURL(feed, fallbackURL): true}
+		if fallbackURL != "" {
+			ours[fallbackURL] = true
+		}
+		cached, err := db.ListCachedFeeds()
+		if err != nil {
+			logger.GettingTwtxtErr(err)
+			res.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		var mentions []TimelineTwt
+		for _, c := range cached {
+			if ours[c.URL] {
+				continue
+			}
+			theirs, err := c.Parse()
+			if err != nil {
+				continue
+			}
+			mentioning := &twtxt.Feed{Comments: theirs.Comments}
+			for _, t := range theirs.Twts {
+				if mentionsOf(t, ours) {
+					mentioning.Twts = append(mentioning.Twts, t)
+				}
+			}
+			mentions = append(mentions, timelineTwts(c.Nick, c.URL, mentioning)...)
+		}
+		writeJSON(logger, res, http.StatusOK, newestTwts(mentions, since, limit))
+	}
+}
@@ -0,0 +1,71 @@
+package twt_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/m25n/twt"
+	"github.com/m25n/twt/task"
+	"github.com/m25n/twt/testhelper"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestFeedFetcherFollowers(t *testing.T) {
+	t.Run("fetches the feeds of single followers", func(t *testing.T) {
+		var fetched []string
+		remote := testhelper.NewServer(t, http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			fetched = append(fetched, req.URL.Path)
+			_, _ = res.Write([]byte(status))
+		}))
+		db, err := twt.NewFileDB(t.TempDir())
+		require.NoError(t, err)
+		_ = db.LogFollower(fmt.Sprintf("twtxt/1.2.3 (+%s/alice.txt; @alice)", remote))
+		_ = db.LogFollower(fmt.Sprintf("yarnd/0.1.0 (~%s/whoFollows; contact=%s/support)", remote, remote))
+		fetcher := twt.NewFeedFetcher(testhelper.DummyLogger{}, db, testhelper.SyncEnqueueTask, twt.NewHTTPClient(time.Second), "twtd/test")
+
+		fetcher.FetchFollowers(context.Background())
+
+		require.Equal(t, []string{"/alice.txt"}, fetched)
+		cached, _ := db.GetCachedFeed(remote + "/alice.txt")
+		require.Equal(t, "alice", cached.Nick)
+		require.Equal(t, status, cached.Content)
+	})
+
+	t.Run("skips unverified followers that were not seen recently", func(t *testing.T) {
+		db := testhelper.NewMockDB()
+		db.FollowerRecords = []twt.FollowerRecord{
+			{Kind: "follower", Nick: "alice", URL: "https://a.example.com/twtxt.txt", LastSeen: time.Now().Add(-48 * time.Hour), Verification: twt.Verified},
+			{Kind: "follower", Nick: "bob", URL: "https://b.example.com/twtxt.txt", LastSeen: time.Now().Add(-48 * time.Hour)},
+			{Kind: "follower", Nick: "carol", URL: "https://c.example.com/twtxt.txt", LastSeen: time.Now()},
+		}
+		var enqueued int
+		enqueue := func(_ context.Context, _ task.Task) error {
+			enqueued++
+			return nil
+		}
+		fetcher := twt.NewFeedFetcher(testhelper.DummyLogger{}, db, enqueue, twt.NewHTTPClient(time.Second), "twtd/test")
+
+		fetcher.FetchFollowers(context.Background())
+
+		require.Equal(t, 2, enqueued)
+	})
+
+	t.Run("refuses feeds on private addresses", func(t *testing.T) {
+		remote := testhelper.NewServer(t, http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			t.Error("fetched a feed on a loopback address")
+		}))
+		logger := testhelper.NewMockLogger()
+		db := testhelper.NewMockDB()
+		db.FollowerRecords = []twt.FollowerRecord{{Kind: "follower", Nick: "alice", URL: remote + "/twtxt.txt", LastSeen: time.Now()}}
+		fetcher := twt.NewFeedFetcher(logger, db, testhelper.SyncEnqueueTask, twt.NewPublicHTTPClient(time.Second), "twtd/test")
+
+		fetcher.FetchFollowers(context.Background())
+
+		require.Len(t, logger.FetchingFeedErrs, 1)
+		var addressErr *twt.NonPublicAddressErr
+		require.ErrorAs(t, logger.FetchingFeedErrs[0], &addressErr)
+		require.Empty(t, db.CachedFeeds)
+	})
+}
@@ -0,0 +1,110 @@
+package twt
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/m25n/twt/twtxt"
+	"net/http"
+	"strings"
+)
+
+var metadataKeys = []string{"nick", "url", "avatar", "description", "follow", "link"}
+
+type metadata map[string][]string
+
+func readMetadata(feed *twtxt.Feed) metadata {
+	m := metadata{}
+	for _, key := range metadataKeys {
+		if values := feed.Metadata(key); len(values) > 0 {
+			m[key] = values
+		}
+	}
+	return m
+}
+
+func (m metadata) validate() error {
+	for key, values := range m {
+		if !knownMetadataKey(key) {
+			return fmt.Errorf("unknown metadata key %q", key)
+		}
+		for _, value := range values {
+			if strings.TrimSpace(value) == "" {
+				return fmt.Errorf("empty value for metadata key %q", key)
+			}
+			if strings.ContainsAny(value, "\r\n") {
+				return fmt.Errorf("value for metadata key %q must be a single line", key)
+			}
+		}
+	}
+	return nil
+}
+
+func knownMetadataKey(key string) bool {
+	for _, k := range metadataKeys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+func getMetadataHandler(logger Logger, db DB) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		feed, err := getFeed(db)
+		if err != nil {
+			logger.GettingTwtxtErr(err)
+			res.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		writeJSON(logger, res, http.StatusOK, readMetadata(feed))
+	}
+}
+
+// patchMetadataHandler replaces the values of the keys in the request body. An
+// empty list removes a key.
+func patchMetadataHandler(logger Logger, db DB) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		var update metadata
+		if err := json.NewDecoder(req.Body).Decode(&update); err != nil {
+			http.Error(res, "invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		if err := update.validate(); err != nil {
+			http.Error(res, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var updated metadata
+		err := db.Rewrite(func(feed *twtxt.Feed) error {
+			for _, key := range metadataKeys {
+				if values, ok := update[key]; ok {
+					feed.SetMetadata(key, values...)
+				}
+			}
+			updated = readMetadata(feed)
+			return nil
+		})
+		if err != nil {
+			logger.RewritingTwtxtErr(err)
+			res.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		writeJSON(logger, res, http.StatusOK, updated)
+	}
+}
+
+func getFeed(db DB) (*twtxt.Feed, error) {
+	file, err := db.Get()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return twtxt.ParseLenient(file)
+}
+
+func writeJSON(logger Logger, res http.ResponseWriter, code int, v interface{}) {
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(code)
+	if err := json.NewEncoder(res).Encode(v); err != nil {
+		logger.WritingBodyErr(err)
+	}
+}
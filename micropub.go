@@ -0,0 +1,296 @@
+package twt
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/m25n/twt/twtxt"
+	"html"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+type micropubError struct {
+	Error       string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func writeMicropubError(logger Logger, res http.ResponseWriter, code int, err string, description string) {
+	writeJSON(logger, res, code, micropubError{Error: err, Description: description})
+}
+
+// micropubAuth accepts the configured or an IndieAuth access token, leaving
+// requests without one to auth.
+func micropubAuth(logger Logger, auth Middleware, cfg *config) Middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		fallback := auth(next)
+		return func(res http.ResponseWriter, req *http.Request) {
+			presented := bearerToken(req)
+			if presented == "" || (cfg.micropubToken == "" && cfg.tokenEndpoint == "") {
+				fallback(res, req)
+				return
+			}
+			if cfg.micropubToken != "" && subtle.ConstantTimeCompare([]byte(cfg.micropubToken), []byte(presented)) == 1 {
+				next(res, req)
+				return
+			}
+			if cfg.tokenEndpoint != "" {
+				ok, err := verifyAccessToken(req.Context(), cfg, presented)
+				if err != nil {
+					logger.VerifyingAccessTokenErr(err)
+				}
+				if ok {
+					next(res, req)
+					return
+				}
+			}
+			writeMicropubError(logger, res, http.StatusForbidden, "forbidden", "invalid access token")
+		}
+	}
+}
+
+func verifyAccessToken(ctx context.Context, cfg *config, token string) (bool, error) {
+	me := siteURL(cfg.feedURL, "./")
+	if me == "" {
+		return false, nil
+	}
+	_, body, err := fetch(ctx, cfg.client, cfg.userAgent, cfg.tokenEndpoint, http.Header{
+		"Accept":        {"application/json"},
+		"Authorization": {"Bearer " + token},
+	})
+	var statusErr *UnexpectedStatusErr
+	if errors.As(err, &statusErr) && statusErr.StatusCode >= 400 && statusErr.StatusCode < 500 {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	var info struct {
+		Me    string `json:"me"`
+		Scope string `json:"scope"`
+	}
+	if err := json.Unmarshal(body, &info); err != nil {
+		return false, err
+	}
+	if strings.TrimSuffix(info.Me, "/") != strings.TrimSuffix(me, "/") {
+		return false, nil
+	}
+	for _, scope := range strings.Fields(info.Scope) {
+		if scope == "create" || scope == "post" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func indieAuthLinks(cfg *config) []string {
+	var links []string
+	if cfg.authorizationEndpoint != "" {
+		links = append(links, fmt.Sprintf(`<%s>; rel="authorization_endpoint"`, cfg.authorizationEndpoint))
+	}
+	if cfg.tokenEndpoint != "" {
+		links = append(links, fmt.Sprintf(`<%s>; rel="token_endpoint"`, cfg.tokenEndpoint))
+	}
+	return links
+}
+
+func bearerToken(req *http.Request) string {
+	if scheme, token, ok := strings.Cut(req.Header.Get("Authorization"), " "); ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+	return req.FormValue("access_token")
+}
+
+type micropubConfig struct {
+	SyndicateTo []string           `json:"syndicate-to"`
+	PostTypes   []micropubPostType `json:"post-types"`
+}
+
+type micropubPostType struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+}
+
+func getMicropubHandler(logger Logger) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		switch req.URL.Query().Get("q") {
+		case "config":
+			writeJSON(logger, res, http.StatusOK, micropubConfig{
+				SyndicateTo: []string{},
+				PostTypes:   []micropubPostType{{Type: "note", Name: "Twt"}},
+			})
+		case "syndicate-to":
+			writeJSON(logger, res, http.StatusOK, map[string][]string{"syndicate-to": {}})
+		default:
+			writeMicropubError(logger, res, http.StatusBadRequest, "invalid_request", "unsupported query")
+		}
+	}
+}
+
+type micropubRequest struct {
+	Type    string
+	Action  string
+	URL     string
+	Content string
+}
+
+var UnsupportedMicropubRequestErr = errors.New("unsupported request body")
+
+func parseMicropubRequest(req *http.Request) (*micropubRequest, error) {
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/json":
+		return parseMicropubJSON(req)
+	case "application/x-www-form-urlencoded", "multipart/form-data":
+		if err := req.ParseMultipartForm(1 << 20); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+			return nil, err
+		}
+		content := req.PostForm["content"]
+		if len(content) == 0 {
+			content = req.PostForm["content[]"]
+		}
+		r := &micropubRequest{Type: "h-entry", Action: req.PostFormValue("action"), URL: req.PostFormValue("url")}
+		if h := req.PostFormValue("h"); h != "" {
+			r.Type = "h-" + h
+		}
+		if len(content) > 0 {
+			r.Content = content[0]
+		}
+		return r, nil
+	default:
+		return nil, UnsupportedMicropubRequestErr
+	}
+}
+
+func parseMicropubJSON(req *http.Request) (*micropubRequest, error) {
+	var body struct {
+		Type       []string                     `json:"type"`
+		Action     string                       `json:"action"`
+		URL        string                       `json:"url"`
+		Properties map[string][]json.RawMessage `json:"properties"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	r := &micropubRequest{Action: body.Action, URL: body.URL}
+	if len(body.Type) > 0 {
+		r.Type = body.Type[0]
+	}
+	if content := body.Properties["content"]; len(content) > 0 {
+		text, err := micropubContent(content[0])
+		if err != nil {
+			return nil, err
+		}
+		r.Content = text
+	}
+	return r, nil
+}
+
+var htmlTagRegex = regexp.MustCompile(`<[^>]*>`)
+
+func micropubContent(raw json.RawMessage) (string, error) {
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return text, nil
+	}
+	var content struct {
+		Value string `json:"value"`
+		HTML  string `json:"html"`
+	}
+	if err := json.Unmarshal(raw, &content); err != nil {
+		return "", err
+	}
+	if content.Value != "" {
+		return content.Value, nil
+	}
+	return html.UnescapeString(htmlTagRegex.ReplaceAllString(content.HTML, "")), nil
+}
+
+func postMicropubHandler(logger Logger, db DB, fallbackURL string, now func() time.Time, notify func(status []byte)) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		r, err := parseMicropubRequest(req)
+		if err != nil {
+			writeMicropubError(logger, res, http.StatusBadRequest, "invalid_request", err.Error())
+			return
+		}
+		switch {
+		case r.Action == "delete":
+			deleteMicropubTwt(logger, db, fallbackURL, res, r.URL)
+		case r.Action != "":
+			writeMicropubError(logger, res, http.StatusBadRequest, "invalid_request", fmt.Sprintf("unsupported action %q", r.Action))
+		case r.Type != "h-entry":
+			writeMicropubError(logger, res, http.StatusBadRequest, "invalid_request", "only h-entry can be created")
+		default:
+			createMicropubTwt(logger, db, fallbackURL, now, notify, res, r.Content)
+		}
+	}
+}
+
+func createMicropubTwt(logger Logger, db DB, fallbackURL string, now func() time.Time, notify func(status []byte), res http.ResponseWriter, content string) {
+	status, err := composeStatus(now(), content)
+	if err == nil {
+		err = ValidateStatus(status)
+	}
+	if err != nil {
+		writeMicropubError(logger, res, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	if err := db.PostStatus(bytes.NewReader(status)); err != nil {
+		logger.PostingStatusErr(err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	notify(status)
+	u := fallbackURL
+	if feed, err := getFeed(db); err != nil {
+		logger.GettingTwtxtErr(err)
+	} else {
+		u = feedURL(feed, fallbackURL)
+	}
+	if t, err := twtxt.ParseTwt(strings.TrimSuffix(string(status), "\n")); err == nil {
+		location := siteURL(u, "twts/"+t.Hash(u))
+		if location == "" {
+			location = "twts/" + t.Hash(u)
+		}
+		res.Header().Set("Location", location)
+	}
+	res.WriteHeader(http.StatusCreated)
+}
+
+func deleteMicropubTwt(logger Logger, db DB, fallbackURL string, res http.ResponseWriter, rawURL string) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		writeMicropubError(logger, res, http.StatusBadRequest, "invalid_request", "invalid url")
+		return
+	}
+	match, ok := parseTwtID(path.Base(u.Path))
+	if !ok {
+		writeMicropubError(logger, res, http.StatusBadRequest, "invalid_request", "url is not a twt")
+		return
+	}
+	err = db.Rewrite(func(feed *twtxt.Feed) error {
+		i, err := findTwt(feed, fallbackURL, match)
+		if err != nil {
+			return err
+		}
+		feed.Twts = append(feed.Twts[:i], feed.Twts[i+1:]...)
+		return nil
+	})
+	switch {
+	case err == nil:
+		res.WriteHeader(http.StatusNoContent)
+	case errors.Is(err, TwtNotFoundErr), errors.Is(err, AmbiguousTwtErr):
+		writeMicropubError(logger, res, http.StatusBadRequest, "invalid_request", err.Error())
+	default:
+		logger.RewritingTwtxtErr(err)
+		res.WriteHeader(http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,78 @@
+package twt
+
+import (
+	"net/http"
+	"time"
+)
+
+type Option func(*config)
+
+type config struct {
+	now       func() time.Time
+	feedURL   string
+	client    *http.Client
+	userAgent string
+	hubURL    string
+
+	micropubToken         string
+	authorizationEndpoint string
+	tokenEndpoint         string
+}
+
+func newConfig(opts []Option) *config {
+	c := &config{now: time.Now, client: NewHTTPClient(30 * time.Second), userAgent: "twtd"}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// WithClock sets the clock used to timestamp statuses posted without one.
+func WithClock(now func() time.Time) Option {
+	return func(c *config) {
+		c.now = now
+	}
+}
+
+// WithFeedURL sets the public URL of twtxt.txt. It is used to compute twt
+// hashes when the feed has no "# url =" metadata.
+func WithFeedURL(feedURL string) Option {
+	return func(c *config) {
+		c.feedURL = feedURL
+	}
+}
+
+// WithHTTPClient sets the client and User-Agent used to verify received
+// webmentions and to send webmentions for new twts.
+func WithHTTPClient(client *http.Client, userAgent string) Option {
+	return func(c *config) {
+		c.client = client
+		c.userAgent = userAgent
+	}
+}
+
+// WithHub makes twtd ping the WebSub hub at hubURL after new statuses instead
+// of acting as its own hub.
+func WithHub(hubURL string) Option {
+	return func(c *config) {
+		c.hubURL = hubURL
+	}
+}
+
+// WithMicropubToken sets the bearer token Micropub clients authenticate
+// with. Without one, Micropub requests authenticate like every other request.
+func WithMicropubToken(token string) Option {
+	return func(c *config) {
+		c.micropubToken = token
+	}
+}
+
+// WithIndieAuth advertises IndieAuth endpoints on the profile page, so
+// Micropub clients can sign in, and accepts the access tokens tokenEndpoint
+// confirms were issued for our site with the create or post scope.
+func WithIndieAuth(authorizationEndpoint string, tokenEndpoint string) Option {
+	return func(c *config) {
+		c.authorizationEndpoint = authorizationEndpoint
+		c.tokenEndpoint = tokenEndpoint
+	}
+}
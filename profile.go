@@ -0,0 +1,74 @@
+package twt
+
+import (
+	"bytes"
+	"embed"
+	"html/template"
+	"regexp"
+	"strings"
+)
+
+//go:embed templates/*.html
+var templateFS embed.FS
+
+var templates = template.Must(template.New("").Funcs(template.FuncMap{
+	"linkify": linkify,
+}).ParseFS(templateFS, "templates/*.html"))
+
+const profileTwts = 50
+
+func renderProfile(v *feedView) ([]byte, error) {
+	page := *v
+	if len(page.Twts) > profileTwts {
+		page.Twts = page.Twts[:profileTwts]
+	}
+	buf := bytes.NewBuffer(nil)
+	if err := templates.ExecuteTemplate(buf, "profile.html", &page); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+var linkifyRegex = regexp.MustCompile(`@<(?:([^ >]+) )?([^ >]+)>|https?://[^\s<>"]+`)
+
+// linkify escapes the text of a twt, turning mentions and URLs into links and
+// twtxt line separators into line breaks.
+func linkify(text string) template.HTML {
+	buf := bytes.NewBuffer(nil)
+	last := 0
+	for _, m := range linkifyRegex.FindAllStringSubmatchIndex(text, -1) {
+		buf.WriteString(escapeLines(text[last:m[0]]))
+		last = m[1]
+		match := text[m[0]:m[1]]
+		if !strings.HasPrefix(match, "@<") {
+			trimmed := strings.TrimRight(match, ".,;:!?)")
+			writeLink(buf, trimmed, trimmed)
+			last = m[0] + len(trimmed)
+			continue
+		}
+		href := text[m[4]:m[5]]
+		label := href
+		if m[2] >= 0 {
+			label = text[m[2]:m[3]]
+		}
+		if _, ok := parseFollowerURL(href); !ok {
+			buf.WriteString(escapeLines(match))
+			continue
+		}
+		writeLink(buf, href, "@"+label)
+	}
+	buf.WriteString(escapeLines(text[last:]))
+	return template.HTML(buf.String())
+}
+
+func writeLink(buf *bytes.Buffer, href string, label string) {
+	buf.WriteString(`<a href="`)
+	buf.WriteString(template.HTMLEscapeString(href))
+	buf.WriteString(`">`)
+	buf.WriteString(template.HTMLEscapeString(label))
+	buf.WriteString(`</a>`)
+}
+
+func escapeLines(text string) string {
+	return strings.ReplaceAll(template.HTMLEscapeString(text), "\u2028", "<br>")
+}
@@ -0,0 +1,145 @@
+package twt
+
+import (
+	"bytes"
+	"github.com/m25n/twt/twtxt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// feedView is our feed prepared for rendering, newest twts first.
+type feedView struct {
+	URL         string
+	Nick        string
+	Avatar      string
+	Description string
+	Updated     time.Time
+	Twts        []twtView
+}
+
+type twtView struct {
+	twtxt.Twt
+	Hash      string
+	Permalink string
+}
+
+// newFeedView counts the feed as updated when its newest twt was created, or
+// at modTime when it has no twts.
+func newFeedView(feed *twtxt.Feed, fallbackURL string, modTime time.Time) *feedView {
+	v := &feedView{
+		URL:         feedURL(feed, fallbackURL),
+		Nick:        firstMetadata(feed, "nick"),
+		Avatar:      firstMetadata(feed, "avatar"),
+		Description: firstMetadata(feed, "description"),
+	}
+	for i := len(feed.Twts) - 1; i >= 0; i-- {
+		t := feed.Twts[i]
+		hash := t.Hash(v.URL)
+		v.Twts = append(v.Twts, twtView{Twt: t, Hash: hash, Permalink: siteURL(v.URL, "twts/"+hash)})
+		if t.Created.After(v.Updated) {
+			v.Updated = t.Created
+		}
+	}
+	if len(v.Twts) == 0 {
+		v.Updated = modTime
+	}
+	return v
+}
+
+// Title names the feed after its nick, falling back to its URL.
+func (v *feedView) Title() string {
+	switch {
+	case v.Nick != "":
+		return v.Nick
+	case v.URL != "":
+		return v.URL
+	default:
+		return "twtxt.txt"
+	}
+}
+
+func firstMetadata(feed *twtxt.Feed, key string) string {
+	if values := feed.Metadata(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// siteURL resolves path against the URL of our feed, or returns an empty
+// string when it is unknown.
+func siteURL(feedURL string, path string) string {
+	if feedURL == "" {
+		return ""
+	}
+	u, err := url.Parse(feedURL)
+	if err != nil {
+		return ""
+	}
+	return u.ResolveReference(&url.URL{Path: path}).String()
+}
+
+const maxTitleLength = 80
+
+var mentionRegex = regexp.MustCompile(`@<([^ >]+) [^>]+>`)
+
+func twtTitle(text string) string {
+	title, _, _ := strings.Cut(plainText(text), "\n")
+	title = strings.TrimSpace(title)
+	if utf8.RuneCountInString(title) <= maxTitleLength {
+		return title
+	}
+	runes := []rune(title)[:maxTitleLength]
+	cut := string(runes)
+	if i := strings.LastIndexByte(cut, ' '); i > maxTitleLength/2 {
+		cut = cut[:i]
+	}
+	return strings.TrimRight(cut, " ,.;:") + "…"
+}
+
+func plainText(text string) string {
+	text = mentionRegex.ReplaceAllString(text, "@$1")
+	return strings.ReplaceAll(text, "\u2028", "\n")
+}
+
+// renderHandler serves a rendering of our feed with validators derived from
+// the feed's. Renderings without a variant get no validators.
+func renderHandler(logger Logger, db DB, fallbackURL string, contentType string, variant string, render func(*feedView) ([]byte, error)) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		file, err := db.Get()
+		if err != nil {
+			logger.GettingTwtxtErr(err)
+			res.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		var etag string
+		var modTime time.Time
+		if v, ok := file.(Versioned); ok {
+			etag = v.ETag()
+			modTime = v.ModTime()
+		}
+		feed, err := twtxt.ParseLenient(file)
+		_ = file.Close()
+		if err != nil {
+			logger.GettingTwtxtErr(err)
+			res.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		body, err := render(newFeedView(feed, fallbackURL, modTime))
+		if err != nil {
+			logger.WritingBodyErr(err)
+			res.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		res.Header().Set("Content-Type", contentType)
+		if variant == "" {
+			modTime = time.Time{}
+		} else if etag != "" {
+			res.Header().Set("ETag", encodedETag(etag, variant))
+		}
+		http.ServeContent(res, req, "", modTime, bytes.NewReader(body))
+	}
+}
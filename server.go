@@ -1,28 +1,80 @@
 package twt
 
 import (
+	"bytes"
 	"context"
 	"github.com/m25n/twt/task"
 	"io"
 	"mime"
 	"net/http"
+	"strings"
 	"time"
 )
 
 type Logger interface {
 	WritingBodyErr(err error)
 	FollowerLoggingErr(err error)
+	FetchingFollowerListErr(err error)
+	VerifyingFollowerErr(err error)
+	FetchingFeedErr(err error)
+	VerifyingWebmentionErr(err error)
+	SendingWebmentionErr(err error)
+	VerifyingSubscriptionErr(err error)
+	PublishingFeedErr(err error)
 	PostingStatusErr(err error)
+	RewritingTwtxtErr(err error)
 	GettingTwtxtErr(err error)
+	GettingFollowersErr(err error)
+	VerifyingAccessTokenErr(err error)
 }
 
 type Middleware func(http.HandlerFunc) http.HandlerFunc
 
-func Handler(logger Logger, db DB, auth Middleware, enqueueTask task.EnqueueFunc) http.Handler {
-	get := getHandler(logger, db, enqueueTask)
-	patch := auth(patchHandler(logger, db))
+func Handler(logger Logger, db DB, auth Middleware, enqueueTask task.EnqueueFunc, opts ...Option) http.Handler {
+	cfg := newConfig(opts)
+	get := getHandler(logger, db, enqueueTask, append(webSubLinks(cfg), webmentionLink(cfg)))
+	sendWebmentions := webmentionNotifier(logger, db, enqueueTask, cfg)
+	publish := websubNotifier(logger, db, enqueueTask, cfg)
+	notify := func(status []byte) {
+		sendWebmentions(status)
+		publish(status)
+	}
+	patch := auth(patchHandler(logger, db, cfg.now, notify))
+	getMetadata := auth(getMetadataHandler(logger, db))
+	patchMetadata := auth(patchMetadataHandler(logger, db))
+	getArchive := getArchiveHandler(logger, db)
+	getFollowers := auth(getFollowersHandler(logger, db, cfg.now))
+	getFollowing := auth(getFollowingHandler(logger, db))
+	postFollowing := auth(postFollowingHandler(logger, db))
+	deleteFollowing := auth(deleteFollowingHandler(logger, db))
+	getTimeline := auth(getTimelineHandler(logger, db, cfg.feedURL, cfg.now))
+	getMentions := auth(getMentionsHandler(logger, db, cfg.feedURL, cfg.now))
+	postWebmention := postWebmentionHandler(logger, db, enqueueTask, cfg)
+	getWebmentions := auth(getWebmentionsHandler(logger, db))
+	postHub := postHubHandler(logger, db, enqueueTask, cfg)
+	getAtom := renderHandler(logger, db, cfg.feedURL, "application/atom+xml; charset=utf-8", "atom", renderAtom)
+	getRSS := renderHandler(logger, db, cfg.feedURL, "application/rss+xml; charset=utf-8", "rss", renderRSS)
+	getJSONFeed := renderHandler(logger, db, cfg.feedURL, "application/feed+json; charset=utf-8", "json", renderJSONFeed)
+	getAPITwts := getAPITwtsHandler(logger, db, cfg.feedURL, cfg.now)
+	getProfile := withLinks(indieAuthLinks(cfg), renderHandler(logger, db, cfg.feedURL, "text/html; charset=utf-8", "html", renderProfile))
+	getCompose := auth(getComposeHandler(logger))
+	postCompose := auth(postComposeHandler(logger, db, cfg.now, notify))
+	micropub := micropubAuth(logger, auth, cfg)
+	getMicropub := micropub(getMicropubHandler(logger))
+	postMicropub := micropub(postMicropubHandler(logger, db, cfg.feedURL, cfg.now, notify))
+	listTwts := listTwtsHandler(logger, db, cfg.feedURL)
+	getTwt := getTwtHandler(logger, db, cfg.feedURL)
+	putTwt := auth(putTwtHandler(logger, db, cfg.feedURL))
+	deleteTwt := auth(deleteTwtHandler(logger, db, cfg.feedURL))
 	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
 		switch {
+		case req.URL.Path == "/":
+			switch req.Method {
+			case http.MethodGet:
+				getProfile(res, req)
+			default:
+				http.Error(res, "Method not allowed", http.StatusMethodNotAllowed)
+			}
 		case req.URL.Path == "/twtxt.txt":
 			switch req.Method {
 			case http.MethodGet:
@@ -32,22 +84,162 @@ func Handler(logger Logger, db DB, auth Middleware, enqueueTask task.EnqueueFunc
 			default:
 				http.Error(res, "Method not allowed", http.StatusMethodNotAllowed)
 			}
+		case req.URL.Path == "/atom.xml":
+			switch req.Method {
+			case http.MethodGet:
+				getAtom(res, req)
+			default:
+				http.Error(res, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+		case req.URL.Path == "/rss.xml":
+			switch req.Method {
+			case http.MethodGet:
+				getRSS(res, req)
+			default:
+				http.Error(res, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+		case req.URL.Path == "/feed.json":
+			switch req.Method {
+			case http.MethodGet:
+				getJSONFeed(res, req)
+			default:
+				http.Error(res, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+		case req.URL.Path == "/api/twts":
+			switch req.Method {
+			case http.MethodGet:
+				getAPITwts(res, req)
+			default:
+				http.Error(res, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+		case isArchivePath(req.URL.Path):
+			switch req.Method {
+			case http.MethodGet:
+				getArchive(res, req)
+			default:
+				http.Error(res, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+		case req.URL.Path == "/followers":
+			switch req.Method {
+			case http.MethodGet:
+				getFollowers(res, req)
+			default:
+				http.Error(res, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+		case req.URL.Path == "/following":
+			switch req.Method {
+			case http.MethodGet:
+				getFollowing(res, req)
+			case http.MethodPost:
+				postFollowing(res, req)
+			case http.MethodDelete:
+				deleteFollowing(res, req)
+			default:
+				http.Error(res, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+		case req.URL.Path == "/timeline":
+			switch req.Method {
+			case http.MethodGet:
+				getTimeline(res, req)
+			default:
+				http.Error(res, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+		case req.URL.Path == "/mentions":
+			switch req.Method {
+			case http.MethodGet:
+				getMentions(res, req)
+			default:
+				http.Error(res, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+		case req.URL.Path == "/webmention":
+			switch req.Method {
+			case http.MethodGet:
+				getWebmentions(res, req)
+			case http.MethodPost:
+				postWebmention(res, req)
+			default:
+				http.Error(res, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+		case req.URL.Path == "/hub":
+			switch req.Method {
+			case http.MethodPost:
+				postHub(res, req)
+			default:
+				http.Error(res, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+		case req.URL.Path == "/compose":
+			switch req.Method {
+			case http.MethodGet:
+				getCompose(res, req)
+			case http.MethodPost:
+				postCompose(res, req)
+			default:
+				http.Error(res, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+		case req.URL.Path == "/micropub":
+			switch req.Method {
+			case http.MethodGet:
+				getMicropub(res, req)
+			case http.MethodPost:
+				postMicropub(res, req)
+			default:
+				http.Error(res, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+		case req.URL.Path == "/metadata":
+			switch req.Method {
+			case http.MethodGet:
+				getMetadata(res, req)
+			case http.MethodPatch:
+				patchMetadata(res, req)
+			default:
+				http.Error(res, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+		case req.URL.Path == "/twts":
+			switch req.Method {
+			case http.MethodGet:
+				listTwts(res, req)
+			default:
+				http.Error(res, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+		case strings.HasPrefix(req.URL.Path, "/twts/"):
+			switch req.Method {
+			case http.MethodGet:
+				getTwt(res, req)
+			case http.MethodPut:
+				putTwt(res, req)
+			case http.MethodDelete:
+				deleteTwt(res, req)
+			default:
+				http.Error(res, "Method not allowed", http.StatusMethodNotAllowed)
+			}
 		default:
 			http.NotFound(res, req)
 		}
 	})
 }
 
-func getHandler(logger Logger, db DB, enqueueTask task.EnqueueFunc) http.HandlerFunc {
+func withLinks(links []string, next http.HandlerFunc) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		for _, link := range links {
+			res.Header().Add("Link", link)
+		}
+		next(res, req)
+	}
+}
+
+func getHandler(logger Logger, db DB, enqueueTask task.EnqueueFunc, links []string) http.HandlerFunc {
 	return func(res http.ResponseWriter, req *http.Request) {
 		res.Header().Set("Content-Type", "text/vnd.twtxt+plain")
+		for _, link := range links {
+			res.Header().Add("Link", link)
+		}
 		file, err := db.Get()
 		if err != nil {
 			logger.GettingTwtxtErr(err)
 			res.WriteHeader(http.StatusInternalServerError)
 			return
 		}
-		_, err = io.Copy(res, file)
+		err = writeTwtxt(res, req, file)
 		_ = file.Close()
 		if err != nil {
 			logger.WritingBodyErr(err)
@@ -69,23 +261,93 @@ func getHandler(logger Logger, db DB, enqueueTask task.EnqueueFunc) http.Handler
 	}
 }
 
-func patchHandler(logger Logger, db DB) http.HandlerFunc {
+// writeTwtxt serves conditional and range requests for seekable files and
+// the best accepted coding of Precompressed ones.
+func writeTwtxt(res http.ResponseWriter, req *http.Request, file io.Reader) error {
+	content, ok := file.(io.ReadSeeker)
+	if !ok {
+		_, err := io.Copy(res, file)
+		return err
+	}
+	var etag string
+	var modTime time.Time
+	if v, ok := file.(Versioned); ok {
+		etag = v.ETag()
+		modTime = v.ModTime()
+	}
+	if p, ok := file.(Precompressed); ok {
+		res.Header().Add("Vary", "Accept-Encoding")
+		if encoding := negotiateEncoding(req.Header.Get("Accept-Encoding")); encoding != "" && req.Header.Get("Range") == "" {
+			if encoded, ok := p.Encoded(encoding); ok {
+				res.Header().Set("Content-Encoding", encoding)
+				etag = encodedETag(etag, encoding)
+				content = encoded
+			}
+		}
+	}
+	if etag != "" {
+		res.Header().Set("ETag", etag)
+	}
+	http.ServeContent(res, req, "", modTime, content)
+	return nil
+}
+
+// enqueueInBackground enqueues tasks without holding up the caller.
+func enqueueInBackground(enqueueTask task.EnqueueFunc, logErr func(error), tasks ...task.Task) {
+	if len(tasks) == 0 {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		for _, t := range tasks {
+			if err := enqueueTask(ctx, t); err != nil {
+				logErr(err)
+				return
+			}
+		}
+	}()
+}
+
+func patchHandler(logger Logger, db DB, now func() time.Time, notify func(status []byte)) http.HandlerFunc {
 	return func(res http.ResponseWriter, req *http.Request) {
+		serverTimestamp := req.URL.Query().Get("timestamp") == "server"
 		mediaType, _, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
 		if err != nil {
 			res.WriteHeader(http.StatusBadRequest)
 			return
 		}
-		if mediaType != "text/vnd.twtxt+plain" && mediaType != "text/vnd.twtxt" {
+		if !twtxtMediaType(mediaType) && !(serverTimestamp && mediaType == "text/plain") {
 			res.WriteHeader(http.StatusUnsupportedMediaType)
 			return
 		}
-		err = db.PostStatus(req.Body)
+		status, err := io.ReadAll(http.MaxBytesReader(res, req.Body, maxStatusSize))
+		if err != nil {
+			http.Error(res, "error reading body", http.StatusBadRequest)
+			return
+		}
+		if serverTimestamp {
+			status, err = timestampStatus(now(), status)
+			if err != nil {
+				http.Error(res, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		if err := ValidateStatus(status); err != nil {
+			http.Error(res, err.Error(), http.StatusBadRequest)
+			return
+		}
+		err = db.PostStatus(bytes.NewReader(status))
 		if err != nil {
 			logger.PostingStatusErr(err)
 			res.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 		res.WriteHeader(http.StatusNoContent)
+		notify(status)
 	}
 }
+
+func twtxtMediaType(mediaType string) bool {
+	return mediaType == "text/vnd.twtxt+plain" || mediaType == "text/vnd.twtxt"
+}
@@ -2,14 +2,24 @@ package twt_test
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"encoding/xml"
 	"errors"
+	"fmt"
 	"github.com/m25n/twt"
+	"github.com/m25n/twt/task"
 	"github.com/m25n/twt/testhelper"
+	"github.com/m25n/twt/twtxt"
 	"github.com/stretchr/testify/require"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
+	"time"
 )
 
 const status = "2022-01-01T00:00:00Z\tI have a thought\n"
@@ -58,6 +68,110 @@ func TestServer(t *testing.T) {
 			require.Equal(t, http.StatusUnsupportedMediaType, res.Code)
 		})
 
+		t.Run("responds bad request with malformed status lines", func(t *testing.T) {
+			for name, tc := range map[string]struct {
+				status string
+				err    string
+			}{
+				"empty":             {"", "line 1: status is empty"},
+				"missing newline":   {"2022-01-01T00:00:00Z\tI have a thought", "line 1: missing trailing newline"},
+				"missing tab":       {"2022-01-01T00:00:00Z I have a thought\n", "line 1: missing tab between timestamp and text"},
+				"invalid timestamp": {"yesterday\tI have a thought\n", "line 1: invalid RFC 3339 timestamp \"yesterday\""},
+				"missing text":      {"2022-01-01T00:00:00Z\t\n", "line 1: missing text"},
+				"second line":       {status + "garbage\n", "line 2: missing tab between timestamp and text"},
+				"carriage return":   {"2022-01-01T00:00:00Z\tI have\ra thought\n", "line 1: unexpected carriage return"},
+			} {
+				t.Run(name, func(t *testing.T) {
+					db := testhelper.NewMockDB()
+					h := twt.Handler(testhelper.DummyLogger{}, db, twt.NoAuth(), testhelper.NoopEnqueueTask)
+
+					res := postStatus(h, tc.status)
+
+					require.Equal(t, http.StatusBadRequest, res.Code)
+					require.Equal(t, tc.err, strings.TrimSpace(res.Body.String()))
+					require.Empty(t, db.StatusLines)
+				})
+			}
+		})
+
+		t.Run("responds bad request when the status is too large", func(t *testing.T) {
+			db := testhelper.NewMockDB()
+			h := twt.Handler(testhelper.DummyLogger{}, db, twt.NoAuth(), testhelper.NoopEnqueueTask)
+
+			res := postStatus(h, "2022-01-01T00:00:00Z\t"+strings.Repeat("a", 1<<20)+"\n")
+
+			require.Equal(t, http.StatusBadRequest, res.Code)
+			require.Empty(t, db.StatusLines)
+		})
+
+		t.Run("accepts multiple status lines", func(t *testing.T) {
+			db := testhelper.NewMockDB()
+			h := twt.Handler(testhelper.DummyLogger{}, db, twt.NoAuth(), testhelper.NoopEnqueueTask)
+
+			res := postStatus(h, status+"2022-01-02T00:00:00+01:00\tAnother thought\n")
+
+			require.Equal(t, http.StatusNoContent, res.Code)
+			require.Equal(t, []string{status + "2022-01-02T00:00:00+01:00\tAnother thought\n"}, db.StatusLines)
+		})
+
+		t.Run("server timestamps", func(t *testing.T) {
+			now := func() time.Time { return time.Date(2022, 1, 1, 12, 0, 0, 0, time.UTC) }
+
+			t.Run("prefixes status text with the current time", func(t *testing.T) {
+				db := testhelper.NewMockDB()
+				h := twt.Handler(testhelper.DummyLogger{}, db, twt.NoAuth(), testhelper.NoopEnqueueTask, twt.WithClock(now))
+
+				res := postStatusText(h, "text/plain", "I have a thought\n")
+
+				require.Equal(t, http.StatusNoContent, res.Code)
+				require.Equal(t, []string{"2022-01-01T12:00:00Z\tI have a thought\n"}, db.StatusLines)
+			})
+
+			t.Run("responds bad request with multiple lines", func(t *testing.T) {
+				db := testhelper.NewMockDB()
+				h := twt.Handler(testhelper.DummyLogger{}, db, twt.NoAuth(), testhelper.NoopEnqueueTask, twt.WithClock(now))
+
+				res := postStatusText(h, "text/plain", "one\ntwo\n")
+
+				require.Equal(t, http.StatusBadRequest, res.Code)
+				require.Empty(t, db.StatusLines)
+			})
+
+			t.Run("responds bad request without text", func(t *testing.T) {
+				db := testhelper.NewMockDB()
+				h := twt.Handler(testhelper.DummyLogger{}, db, twt.NoAuth(), testhelper.NoopEnqueueTask, twt.WithClock(now))
+
+				res := postStatusText(h, "text/plain", "")
+
+				require.Equal(t, http.StatusBadRequest, res.Code)
+				require.Empty(t, db.StatusLines)
+			})
+
+			t.Run("responds unsupported media type", func(t *testing.T) {
+				h := twt.Handler(testhelper.DummyLogger{}, testhelper.NewMockDB(), twt.NoAuth(), testhelper.NoopEnqueueTask, twt.WithClock(now))
+
+				res := postStatusText(h, "application/json", `{"text":"I have a thought"}`)
+
+				require.Equal(t, http.StatusUnsupportedMediaType, res.Code)
+			})
+		})
+
+		t.Run("responds without waiting for notifications to be enqueued", func(t *testing.T) {
+			db := testhelper.NewFakeDB()
+			_ = db.PutSubscription(twt.Subscription{Callback: "https://sub.example.com/callback", Topic: "https://example.com/twtxt.txt", Expires: time.Now().Add(time.Hour)})
+			full := func(ctx context.Context, _ task.Task) error {
+				<-ctx.Done()
+				return ctx.Err()
+			}
+			h := twt.Handler(testhelper.DummyLogger{}, db, twt.NoAuth(), full, twt.WithFeedURL("https://example.com/twtxt.txt"))
+			start := time.Now()
+
+			res := postStatus(h, "2022-01-01T00:00:00Z\tHello @<alice https://a.example.com/twtxt.txt>\n")
+
+			require.Equal(t, http.StatusNoContent, res.Code)
+			require.Less(t, time.Since(start), time.Second)
+		})
+
 		t.Run("responds internal server error when database fails", func(t *testing.T) {
 			postErr := errors.New("post err")
 			h := twt.Handler(testhelper.DummyLogger{}, &testhelper.StubDB{PostStatusErr: postErr}, twt.NoAuth(), testhelper.NoopEnqueueTask)
@@ -99,6 +213,169 @@ func TestServer(t *testing.T) {
 			require.Equal(t, http.StatusOK, res.Code)
 		})
 
+		t.Run("conditional requests", func(t *testing.T) {
+			modTime := time.Date(2022, 1, 1, 12, 0, 0, 0, time.UTC)
+			newDB := func() *testhelper.StubDB {
+				return &testhelper.StubDB{GetReadCloser: testhelper.NewVersionedReadCloser(status, `"v1"`, modTime)}
+			}
+			get := func(h http.Handler, header string, value string) *httptest.ResponseRecorder {
+				res := httptest.NewRecorder()
+				req, _ := http.NewRequest("GET", "/twtxt.txt", nil)
+				req.Header.Set(header, value)
+				h.ServeHTTP(res, req)
+				return res
+			}
+
+			t.Run("responds with validators", func(t *testing.T) {
+				h := twt.Handler(testhelper.DummyLogger{}, newDB(), twt.NoAuth(), testhelper.NoopEnqueueTask)
+
+				res := get(h, "Accept", "*/*")
+
+				require.Equal(t, http.StatusOK, res.Code)
+				require.Equal(t, `"v1"`, res.Header().Get("ETag"))
+				require.Equal(t, "Sat, 01 Jan 2022 12:00:00 GMT", res.Header().Get("Last-Modified"))
+				require.Equal(t, status, res.Body.String())
+			})
+
+			for name, tc := range map[string]struct {
+				header string
+				value  string
+				code   int
+			}{
+				"matching etag":             {"If-None-Match", `"v0", "v1"`, http.StatusNotModified},
+				"weak matching etag":        {"If-None-Match", `W/"v1"`, http.StatusNotModified},
+				"any etag":                  {"If-None-Match", `*`, http.StatusNotModified},
+				"changed etag":              {"If-None-Match", `"v0"`, http.StatusOK},
+				"unmodified since":          {"If-Modified-Since", "Sat, 01 Jan 2022 12:00:00 GMT", http.StatusNotModified},
+				"modified since":            {"If-Modified-Since", "Sat, 01 Jan 2022 11:59:59 GMT", http.StatusOK},
+				"invalid if-modified-since": {"If-Modified-Since", "yesterday", http.StatusOK},
+			} {
+				t.Run(name, func(t *testing.T) {
+					h := twt.Handler(testhelper.DummyLogger{}, newDB(), twt.NoAuth(), testhelper.NoopEnqueueTask)
+
+					res := get(h, tc.header, tc.value)
+
+					require.Equal(t, tc.code, res.Code)
+					if tc.code == http.StatusNotModified {
+						require.Empty(t, res.Body.String())
+					}
+				})
+			}
+
+			t.Run("serves byte ranges", func(t *testing.T) {
+				h := twt.Handler(testhelper.DummyLogger{}, newDB(), twt.NoAuth(), testhelper.NoopEnqueueTask)
+
+				res := get(h, "Range", "bytes=21-")
+
+				require.Equal(t, http.StatusPartialContent, res.Code)
+				require.Equal(t, "bytes", res.Header().Get("Accept-Ranges"))
+				require.Equal(t, fmt.Sprintf("bytes 21-%d/%d", len(status)-1, len(status)), res.Header().Get("Content-Range"))
+				require.Equal(t, "I have a thought\n", res.Body.String())
+				require.Equal(t, "text/vnd.twtxt+plain", res.Header().Get("Content-Type"))
+			})
+
+			t.Run("responds range not satisfiable past the end", func(t *testing.T) {
+				h := twt.Handler(testhelper.DummyLogger{}, newDB(), twt.NoAuth(), testhelper.NoopEnqueueTask)
+
+				res := get(h, "Range", fmt.Sprintf("bytes=%d-", len(status)))
+
+				require.Equal(t, http.StatusRequestedRangeNotSatisfiable, res.Code)
+				require.Equal(t, fmt.Sprintf("bytes */%d", len(status)), res.Header().Get("Content-Range"))
+			})
+
+			t.Run("ignores ranges of an outdated version", func(t *testing.T) {
+				h := twt.Handler(testhelper.DummyLogger{}, newDB(), twt.NoAuth(), testhelper.NoopEnqueueTask)
+
+				res := httptest.NewRecorder()
+				req, _ := http.NewRequest("GET", "/twtxt.txt", nil)
+				req.Header.Set("Range", "bytes=21-")
+				req.Header.Set("If-Range", `"v0"`)
+				h.ServeHTTP(res, req)
+
+				require.Equal(t, http.StatusOK, res.Code)
+				require.Equal(t, status, res.Body.String())
+			})
+
+			t.Run("compression", func(t *testing.T) {
+				gzipped := gzipString(t, status)
+				newDB := func() *testhelper.StubDB {
+					file := testhelper.NewVersionedReadCloser(status, `"v1"`, modTime)
+					file.Encodings = map[string][]byte{"gzip": gzipped}
+					return &testhelper.StubDB{GetReadCloser: file}
+				}
+
+				t.Run("serves the precompressed feed", func(t *testing.T) {
+					h := twt.Handler(testhelper.DummyLogger{}, newDB(), twt.NoAuth(), testhelper.NoopEnqueueTask)
+
+					res := get(h, "Accept-Encoding", "br;q=1.0, gzip;q=0.8")
+
+					require.Equal(t, http.StatusOK, res.Code)
+					require.Equal(t, "gzip", res.Header().Get("Content-Encoding"))
+					require.Equal(t, "Accept-Encoding", res.Header().Get("Vary"))
+					require.Equal(t, `"v1-gzip"`, res.Header().Get("ETag"))
+					require.Equal(t, "text/vnd.twtxt+plain", res.Header().Get("Content-Type"))
+					require.Equal(t, gzipped, res.Body.Bytes())
+				})
+
+				for name, acceptEncoding := range map[string]string{
+					"no accept-encoding": "",
+					"gzip refused":       "gzip;q=0, deflate",
+					"wildcard refused":   "*;q=0",
+				} {
+					t.Run("serves the identity feed with "+name, func(t *testing.T) {
+						h := twt.Handler(testhelper.DummyLogger{}, newDB(), twt.NoAuth(), testhelper.NoopEnqueueTask)
+
+						res := get(h, "Accept-Encoding", acceptEncoding)
+
+						require.Empty(t, res.Header().Get("Content-Encoding"))
+						require.Equal(t, `"v1"`, res.Header().Get("ETag"))
+						require.Equal(t, status, res.Body.String())
+					})
+				}
+
+				t.Run("serves ranges of the identity feed", func(t *testing.T) {
+					h := twt.Handler(testhelper.DummyLogger{}, newDB(), twt.NoAuth(), testhelper.NoopEnqueueTask)
+
+					res := httptest.NewRecorder()
+					req, _ := http.NewRequest("GET", "/twtxt.txt", nil)
+					req.Header.Set("Accept-Encoding", "gzip")
+					req.Header.Set("Range", "bytes=21-")
+					h.ServeHTTP(res, req)
+
+					require.Equal(t, http.StatusPartialContent, res.Code)
+					require.Empty(t, res.Header().Get("Content-Encoding"))
+					require.Equal(t, `"v1"`, res.Header().Get("ETag"))
+					require.Equal(t, status[21:], res.Body.String())
+				})
+
+				t.Run("honors conditional requests for the compressed feed", func(t *testing.T) {
+					h := twt.Handler(testhelper.DummyLogger{}, newDB(), twt.NoAuth(), testhelper.NoopEnqueueTask)
+
+					res := httptest.NewRecorder()
+					req, _ := http.NewRequest("GET", "/twtxt.txt", nil)
+					req.Header.Set("Accept-Encoding", "gzip")
+					req.Header.Set("If-None-Match", `"v1-gzip"`)
+					h.ServeHTTP(res, req)
+
+					require.Equal(t, http.StatusNotModified, res.Code)
+				})
+			})
+
+			t.Run("logs followers when not modified", func(t *testing.T) {
+				db := testhelper.NewMockDB()
+				h := twt.Handler(testhelper.DummyLogger{}, &versionedMockDB{db}, twt.NoAuth(), testhelper.SyncEnqueueTask)
+
+				res := httptest.NewRecorder()
+				req, _ := http.NewRequest("GET", "/twtxt.txt", nil)
+				req.Header.Set("If-None-Match", `"v1"`)
+				req.Header.Set("User-Agent", "twtxt/1.2.3 (+https://example.com/twtxt.txt; @somebody)")
+				h.ServeHTTP(res, req)
+
+				require.Equal(t, http.StatusNotModified, res.Code)
+				require.Contains(t, db.Followers, "twtxt/1.2.3 (+https://example.com/twtxt.txt; @somebody)")
+			})
+		})
+
 		t.Run("responds with internal server error when the database has an error", func(t *testing.T) {
 			h := twt.Handler(testhelper.DummyLogger{}, &testhelper.StubDB{GetErr: errors.New("db error")}, twt.NoAuth(), testhelper.NoopEnqueueTask)
 
@@ -167,30 +444,1381 @@ func TestServer(t *testing.T) {
 		})
 	})
 
-	t.Run("posted statuses can be read back", func(t *testing.T) {
-		h := twt.Handler(testhelper.DummyLogger{}, testhelper.NewFakeDB(), twt.NoAuth(), testhelper.NoopEnqueueTask)
+	t.Run("archives", func(t *testing.T) {
+		t.Run("serves archive files", func(t *testing.T) {
+			archive := io.NopCloser(bytes.NewBufferString(status))
+			h := twt.Handler(testhelper.DummyLogger{}, &testhelper.StubDB{GetArchiveReadCloser: archive}, twt.NoAuth(), testhelper.NoopEnqueueTask)
 
-		_ = postStatus(h, status)
-		twtxt := getTwtxt(h)
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/twtxt-abcdefg.txt", nil)
+			h.ServeHTTP(res, req)
 
-		require.Equal(t, status, twtxt)
+			require.Equal(t, http.StatusOK, res.Code)
+			require.Equal(t, "text/vnd.twtxt+plain", res.Header().Get("Content-Type"))
+			require.Equal(t, status, res.Body.String())
+		})
+
+		t.Run("responds not found for missing archives", func(t *testing.T) {
+			h := twt.Handler(testhelper.DummyLogger{}, &testhelper.StubDB{GetArchiveErr: twt.ArchiveNotFoundErr}, twt.NoAuth(), testhelper.NoopEnqueueTask)
+
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/twtxt-abcdefg.txt", nil)
+			h.ServeHTTP(res, req)
+
+			require.Equal(t, http.StatusNotFound, res.Code)
+		})
 	})
-}
 
-func getTwtxt(h http.Handler) string {
-	res := httptest.NewRecorder()
-	req, _ := http.NewRequest("GET", "/twtxt.txt", nil)
-	h.ServeHTTP(res, req)
-	buf := bytes.NewBuffer(nil)
-	_, _ = io.Copy(buf, res.Body)
-	return buf.String()
-}
+	t.Run("followers", func(t *testing.T) {
+		now := time.Date(2022, 1, 10, 0, 0, 0, 0, time.UTC)
+		records := []twt.FollowerRecord{
+			{
+				Kind:      "follower",
+				Nick:      "somebody",
+				URL:       "https://example.com/twtxt.txt",
+				FirstSeen: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+				LastSeen:  time.Date(2022, 1, 9, 12, 0, 0, 0, time.UTC),
+				Fetches:   12,
+				UserAgent: "twtxt/1.2.3 (+https://example.com/twtxt.txt; @somebody)",
+			},
+			{
+				Kind:       "list",
+				URL:        "https://pod.example.com/whoFollows?token=abc",
+				ContactURL: "https://pod.example.com/support",
+				FirstSeen:  time.Date(2022, 1, 2, 0, 0, 0, 0, time.UTC),
+				LastSeen:   time.Date(2022, 1, 5, 0, 0, 0, 0, time.UTC),
+				Fetches:    3,
+				UserAgent:  "yarnd/0.1.0 (~https://pod.example.com/whoFollows?token=abc; contact=https://pod.example.com/support)",
+			},
+		}
+		getFollowers := func(h http.Handler, query string, accept string) *httptest.ResponseRecorder {
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/followers"+query, nil)
+			req.Header.Set("Accept", accept)
+			h.ServeHTTP(res, req)
+			return res
+		}
 
-func postStatus(h http.Handler, status string) *httptest.ResponseRecorder {
-	res := httptest.NewRecorder()
-	buf := bytes.NewBufferString(status)
-	req, _ := http.NewRequest("PATCH", "/twtxt.txt", buf)
-	req.Header.Set("Content-Type", "text/vnd.twtxt+plain")
-	h.ServeHTTP(res, req)
-	return res
+		t.Run("lists followers as json", func(t *testing.T) {
+			h := twt.Handler(testhelper.DummyLogger{}, &testhelper.StubDB{FollowerRecords: records}, twt.NoAuth(), testhelper.NoopEnqueueTask, twt.WithClock(func() time.Time { return now }))
+
+			res := getFollowers(h, "", "")
+
+			require.Equal(t, http.StatusOK, res.Code)
+			require.Equal(t, "application/json", res.Header().Get("Content-Type"))
+			var followers []twt.FollowerRecord
+			require.NoError(t, json.Unmarshal(res.Body.Bytes(), &followers))
+			require.Equal(t, records, followers)
+		})
+
+		t.Run("lists followers as twtxt style lines", func(t *testing.T) {
+			h := twt.Handler(testhelper.DummyLogger{}, &testhelper.StubDB{FollowerRecords: records}, twt.NoAuth(), testhelper.NoopEnqueueTask, twt.WithClock(func() time.Time { return now }))
+
+			res := getFollowers(h, "", "text/plain, application/json;q=0.5")
+
+			require.Equal(t, http.StatusOK, res.Code)
+			require.Equal(t, "follower\tsomebody\thttps://example.com/twtxt.txt\n"+
+				"list\thttps://pod.example.com/whoFollows?token=abc\thttps://pod.example.com/support\n", res.Body.String())
+		})
+
+		t.Run("filters by last seen", func(t *testing.T) {
+			for name, since := range map[string]string{
+				"duration":  "?since=48h",
+				"timestamp": "?since=2022-01-08T00:00:00Z",
+			} {
+				t.Run(name, func(t *testing.T) {
+					h := twt.Handler(testhelper.DummyLogger{}, &testhelper.StubDB{FollowerRecords: records}, twt.NoAuth(), testhelper.NoopEnqueueTask, twt.WithClock(func() time.Time { return now }))
+
+					res := getFollowers(h, since, "text/plain")
+
+					require.Equal(t, "follower\tsomebody\thttps://example.com/twtxt.txt\n", res.Body.String())
+				})
+			}
+		})
+
+		t.Run("responds bad request with an invalid since", func(t *testing.T) {
+			h := twt.Handler(testhelper.DummyLogger{}, &testhelper.StubDB{FollowerRecords: records}, twt.NoAuth(), testhelper.NoopEnqueueTask)
+
+			res := getFollowers(h, "?since=last+week", "")
+
+			require.Equal(t, http.StatusBadRequest, res.Code)
+		})
+
+		t.Run("logs error and responds internal server error when the database fails", func(t *testing.T) {
+			logger := testhelper.NewMockLogger()
+			dbErr := errors.New("db error")
+			h := twt.Handler(logger, &testhelper.StubDB{FollowersErr: dbErr}, twt.NoAuth(), testhelper.NoopEnqueueTask)
+
+			res := getFollowers(h, "", "")
+
+			require.Equal(t, http.StatusInternalServerError, res.Code)
+			require.Contains(t, logger.GettingFollowersErrs, dbErr)
+		})
+
+		t.Run("requires authentication", func(t *testing.T) {
+			h := twt.Handler(testhelper.DummyLogger{}, &testhelper.StubDB{FollowerRecords: records}, twt.BasicAuth("user", "password"), testhelper.NoopEnqueueTask)
+
+			res := getFollowers(h, "", "")
+
+			require.Equal(t, http.StatusUnauthorized, res.Code)
+		})
+	})
+
+	t.Run("metadata", func(t *testing.T) {
+		t.Run("updates and reads back metadata", func(t *testing.T) {
+			h := twt.Handler(testhelper.DummyLogger{}, testhelper.NewFakeDB(), twt.NoAuth(), testhelper.NoopEnqueueTask)
+
+			res := patchMetadata(h, `{"nick":["somebody"],"follow":["a https://a.example.com/twtxt.txt","b https://b.example.com/twtxt.txt"]}`)
+			require.Equal(t, http.StatusOK, res.Code)
+
+			res = httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/metadata", nil)
+			h.ServeHTTP(res, req)
+
+			require.Equal(t, http.StatusOK, res.Code)
+			require.Equal(t, "application/json", res.Header().Get("Content-Type"))
+			require.JSONEq(t, `{"nick":["somebody"],"follow":["a https://a.example.com/twtxt.txt","b https://b.example.com/twtxt.txt"]}`, res.Body.String())
+		})
+
+		t.Run("skips lines that are not twts", func(t *testing.T) {
+			db := &testhelper.StubDB{GetReadCloser: io.NopCloser(strings.NewReader("# nick = somebody\nnot a twt\n" + status))}
+			h := twt.Handler(testhelper.DummyLogger{}, db, twt.NoAuth(), testhelper.NoopEnqueueTask)
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/metadata", nil)
+
+			h.ServeHTTP(res, req)
+
+			require.Equal(t, http.StatusOK, res.Code)
+			require.JSONEq(t, `{"nick":["somebody"]}`, res.Body.String())
+		})
+
+		t.Run("preserves status lines", func(t *testing.T) {
+			h := twt.Handler(testhelper.DummyLogger{}, testhelper.NewFakeDB(), twt.NoAuth(), testhelper.NoopEnqueueTask)
+			_ = postStatus(h, status)
+
+			_ = patchMetadata(h, `{"nick":["somebody"]}`)
+
+			require.Equal(t, "# nick = somebody\n"+status, getTwtxt(h))
+		})
+
+		t.Run("removes keys with no values", func(t *testing.T) {
+			h := twt.Handler(testhelper.DummyLogger{}, testhelper.NewFakeDB(), twt.NoAuth(), testhelper.NoopEnqueueTask)
+			_ = patchMetadata(h, `{"nick":["somebody"],"url":["https://example.com/twtxt.txt"]}`)
+
+			res := patchMetadata(h, `{"nick":[]}`)
+
+			require.JSONEq(t, `{"url":["https://example.com/twtxt.txt"]}`, res.Body.String())
+		})
+
+		t.Run("responds bad request with invalid metadata", func(t *testing.T) {
+			for name, body := range map[string]string{
+				"invalid json":    `{"nick":`,
+				"unknown key":     `{"color":["blue"]}`,
+				"empty value":     `{"nick":[" "]}`,
+				"multiline value": `{"description":["one\ntwo"]}`,
+			} {
+				t.Run(name, func(t *testing.T) {
+					db := testhelper.NewMockDB()
+					h := twt.Handler(testhelper.DummyLogger{}, db, twt.NoAuth(), testhelper.NoopEnqueueTask)
+
+					res := patchMetadata(h, body)
+
+					require.Equal(t, http.StatusBadRequest, res.Code)
+					require.Empty(t, db.Feed.Comments)
+				})
+			}
+		})
+
+		t.Run("logs error and responds internal server error when the database fails", func(t *testing.T) {
+			logger := testhelper.NewMockLogger()
+			rewriteErr := errors.New("rewrite error")
+			h := twt.Handler(logger, &testhelper.StubDB{RewriteErr: rewriteErr}, twt.NoAuth(), testhelper.NoopEnqueueTask)
+
+			res := patchMetadata(h, `{"nick":["somebody"]}`)
+
+			require.Equal(t, http.StatusInternalServerError, res.Code)
+			require.Contains(t, logger.RewritingTwtxtErrs, rewriteErr)
+		})
+
+		t.Run("requires authentication", func(t *testing.T) {
+			h := twt.Handler(testhelper.DummyLogger{}, testhelper.NewFakeDB(), twt.BasicAuth("user", "password"), testhelper.NoopEnqueueTask)
+
+			for _, method := range []string{"GET", "PATCH"} {
+				res := httptest.NewRecorder()
+				req, _ := http.NewRequest(method, "/metadata", nil)
+				h.ServeHTTP(res, req)
+
+				require.Equal(t, http.StatusUnauthorized, res.Code)
+			}
+		})
+	})
+
+	t.Run("twts", func(t *testing.T) {
+		const other = "2022-01-02T00:00:00+01:00\tAnother thought\n"
+
+		t.Run("deletes a twt by timestamp", func(t *testing.T) {
+			h := twt.Handler(testhelper.DummyLogger{}, testhelper.NewFakeDB(), twt.NoAuth(), testhelper.NoopEnqueueTask)
+			_ = postStatus(h, status+other)
+
+			res := deleteTwt(h, "2022-01-01T00:00:00Z")
+
+			require.Equal(t, http.StatusNoContent, res.Code)
+			require.Equal(t, other, getTwtxt(h))
+		})
+
+		t.Run("edits the text of a twt by timestamp", func(t *testing.T) {
+			h := twt.Handler(testhelper.DummyLogger{}, testhelper.NewFakeDB(), twt.NoAuth(), testhelper.NoopEnqueueTask)
+			_ = postStatus(h, status+other)
+
+			res := putTwt(h, "2022-01-02T00:00:00+01:00", "text/plain", "A better thought\n")
+
+			require.Equal(t, http.StatusNoContent, res.Code)
+			require.Equal(t, status+"2022-01-02T00:00:00+01:00\tA better thought\n", getTwtxt(h))
+		})
+
+		t.Run("looks up a twt by hash", func(t *testing.T) {
+			h := twt.Handler(testhelper.DummyLogger{}, testhelper.NewFakeDB(), twt.NoAuth(), testhelper.NoopEnqueueTask, twt.WithFeedURL("https://example.com/twtxt.txt"))
+			_ = postStatus(h, status+other)
+
+			res := getTwt(h, twtHash(t, other, "https://example.com/twtxt.txt"))
+
+			require.Equal(t, http.StatusOK, res.Code)
+			require.Equal(t, "text/vnd.twtxt+plain", res.Header().Get("Content-Type"))
+			require.Equal(t, other, res.Body.String())
+		})
+
+		t.Run("prefers the url metadata for hashes", func(t *testing.T) {
+			h := twt.Handler(testhelper.DummyLogger{}, testhelper.NewFakeDB(), twt.NoAuth(), testhelper.NoopEnqueueTask, twt.WithFeedURL("https://example.com/twtxt.txt"))
+			_ = postStatus(h, status)
+			_ = patchMetadata(h, `{"url":["https://example.org/twtxt.txt"]}`)
+
+			require.Equal(t, http.StatusOK, getTwt(h, twtHash(t, status, "https://example.org/twtxt.txt")).Code)
+			require.Equal(t, http.StatusNotFound, getTwt(h, twtHash(t, status, "https://example.com/twtxt.txt")).Code)
+		})
+
+		t.Run("lists twts with their hashes", func(t *testing.T) {
+			h := twt.Handler(testhelper.DummyLogger{}, testhelper.NewFakeDB(), twt.NoAuth(), testhelper.NoopEnqueueTask, twt.WithFeedURL("https://example.com/twtxt.txt"))
+			_ = postStatus(h, status+other)
+
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/twts", nil)
+			h.ServeHTTP(res, req)
+
+			require.Equal(t, http.StatusOK, res.Code)
+			require.Equal(t, twtHash(t, status, "https://example.com/twtxt.txt")+"\t"+status+twtHash(t, other, "https://example.com/twtxt.txt")+"\t"+other, res.Body.String())
+		})
+
+		t.Run("deletes and edits a twt by hash", func(t *testing.T) {
+			h := twt.Handler(testhelper.DummyLogger{}, testhelper.NewFakeDB(), twt.NoAuth(), testhelper.NoopEnqueueTask, twt.WithFeedURL("https://example.com/twtxt.txt"))
+			_ = postStatus(h, status+other)
+
+			require.Equal(t, http.StatusNoContent, putTwt(h, twtHash(t, other, "https://example.com/twtxt.txt"), "text/plain", "A better thought").Code)
+			require.Equal(t, http.StatusNoContent, deleteTwt(h, twtHash(t, status, "https://example.com/twtxt.txt")).Code)
+			require.Equal(t, "2022-01-02T00:00:00+01:00\tA better thought\n", getTwtxt(h))
+		})
+
+		t.Run("responds not found", func(t *testing.T) {
+			for name, id := range map[string]string{
+				"unknown timestamp": "2021-01-01T00:00:00Z",
+				"invalid id":        "yesterday",
+			} {
+				t.Run(name, func(t *testing.T) {
+					h := twt.Handler(testhelper.DummyLogger{}, testhelper.NewFakeDB(), twt.NoAuth(), testhelper.NoopEnqueueTask)
+					_ = postStatus(h, status)
+
+					require.Equal(t, http.StatusNotFound, deleteTwt(h, id).Code)
+					require.Equal(t, http.StatusNotFound, putTwt(h, id, "text/plain", "A better thought").Code)
+					require.Equal(t, status, getTwtxt(h))
+				})
+			}
+		})
+
+		t.Run("responds conflict when the timestamp is ambiguous", func(t *testing.T) {
+			h := twt.Handler(testhelper.DummyLogger{}, testhelper.NewFakeDB(), twt.NoAuth(), testhelper.NoopEnqueueTask)
+			_ = postStatus(h, status+"2022-01-01T01:00:00+01:00\tSame time elsewhere\n")
+
+			res := deleteTwt(h, "2022-01-01T00:00:00Z")
+
+			require.Equal(t, http.StatusConflict, res.Code)
+		})
+
+		t.Run("responds bad request when editing with invalid text", func(t *testing.T) {
+			h := twt.Handler(testhelper.DummyLogger{}, testhelper.NewFakeDB(), twt.NoAuth(), testhelper.NoopEnqueueTask)
+			_ = postStatus(h, status)
+
+			require.Equal(t, http.StatusBadRequest, putTwt(h, "2022-01-01T00:00:00Z", "text/plain", "one\ntwo").Code)
+			require.Equal(t, http.StatusBadRequest, putTwt(h, "2022-01-01T00:00:00Z", "text/plain", "").Code)
+			require.Equal(t, status, getTwtxt(h))
+		})
+
+		t.Run("responds unsupported media type when editing", func(t *testing.T) {
+			h := twt.Handler(testhelper.DummyLogger{}, testhelper.NewFakeDB(), twt.NoAuth(), testhelper.NoopEnqueueTask)
+			_ = postStatus(h, status)
+
+			res := putTwt(h, "2022-01-01T00:00:00Z", "application/json", `"A better thought"`)
+
+			require.Equal(t, http.StatusUnsupportedMediaType, res.Code)
+		})
+
+		t.Run("logs error and responds internal server error when the database fails", func(t *testing.T) {
+			logger := testhelper.NewMockLogger()
+			rewriteErr := errors.New("rewrite error")
+			h := twt.Handler(logger, &testhelper.StubDB{RewriteErr: rewriteErr}, twt.NoAuth(), testhelper.NoopEnqueueTask)
+
+			res := deleteTwt(h, "2022-01-01T00:00:00Z")
+
+			require.Equal(t, http.StatusInternalServerError, res.Code)
+			require.Contains(t, logger.RewritingTwtxtErrs, rewriteErr)
+		})
+
+		t.Run("requires authentication", func(t *testing.T) {
+			h := twt.Handler(testhelper.DummyLogger{}, testhelper.NewFakeDB(), twt.BasicAuth("user", "password"), testhelper.NoopEnqueueTask)
+
+			require.Equal(t, http.StatusUnauthorized, deleteTwt(h, "2022-01-01T00:00:00Z").Code)
+			require.Equal(t, http.StatusUnauthorized, putTwt(h, "2022-01-01T00:00:00Z", "text/plain", "A better thought").Code)
+		})
+	})
+
+	t.Run("following", func(t *testing.T) {
+		const alice = "https://alice.example.com/twtxt.txt"
+
+		t.Run("follows feeds and lists them", func(t *testing.T) {
+			h := twt.Handler(testhelper.DummyLogger{}, testhelper.NewFakeDB(), twt.NoAuth(), testhelper.NoopEnqueueTask)
+
+			require.Equal(t, http.StatusOK, follow(h, `{"nick":"alice","url":"`+alice+`"}`).Code)
+			require.Equal(t, http.StatusOK, follow(h, `{"nick":"bob","url":"https://bob.example.com/twtxt.txt"}`).Code)
+			res := follow(h, `{"nick":"alicia","url":"`+alice+`"}`)
+
+			require.JSONEq(t, `[{"nick":"alicia","url":"`+alice+`"},{"nick":"bob","url":"https://bob.example.com/twtxt.txt"}]`, res.Body.String())
+			require.Equal(t, "# follow = alicia "+alice+"\n# follow = bob https://bob.example.com/twtxt.txt\n", getTwtxt(h))
+		})
+
+		t.Run("unfollows feeds", func(t *testing.T) {
+			h := twt.Handler(testhelper.DummyLogger{}, testhelper.NewFakeDB(), twt.NoAuth(), testhelper.NoopEnqueueTask)
+			_ = follow(h, `{"nick":"alice","url":"`+alice+`"}`)
+
+			require.Equal(t, http.StatusNoContent, unfollow(h, alice).Code)
+			require.Equal(t, http.StatusNotFound, unfollow(h, alice).Code)
+
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/following", nil)
+			h.ServeHTTP(res, req)
+			require.JSONEq(t, `[]`, res.Body.String())
+		})
+
+		t.Run("responds bad request with invalid follows", func(t *testing.T) {
+			for name, body := range map[string]string{
+				"invalid json": `{"nick":`,
+				"invalid nick": `{"nick":"not a nick","url":"` + alice + `"}`,
+				"invalid url":  `{"nick":"alice","url":"ftp://alice.example.com/twtxt.txt"}`,
+			} {
+				t.Run(name, func(t *testing.T) {
+					db := testhelper.NewMockDB()
+					h := twt.Handler(testhelper.DummyLogger{}, db, twt.NoAuth(), testhelper.NoopEnqueueTask)
+
+					res := follow(h, body)
+
+					require.Equal(t, http.StatusBadRequest, res.Code)
+					require.Empty(t, db.Feed.Comments)
+				})
+			}
+		})
+
+		t.Run("requires authentication", func(t *testing.T) {
+			h := twt.Handler(testhelper.DummyLogger{}, testhelper.NewFakeDB(), twt.BasicAuth("user", "password"), testhelper.NoopEnqueueTask)
+
+			require.Equal(t, http.StatusUnauthorized, follow(h, `{"nick":"alice","url":"`+alice+`"}`).Code)
+			require.Equal(t, http.StatusUnauthorized, unfollow(h, alice).Code)
+		})
+	})
+
+	t.Run("timeline", func(t *testing.T) {
+		const alice = "https://alice.example.com/twtxt.txt"
+		newDB := func() *testhelper.FakeDB {
+			db := testhelper.NewFakeDB()
+			_ = db.PutCachedFeed(&twt.CachedFeed{
+				URL:     alice,
+				Content: "# nick = alice\n2022-01-01T12:00:00Z\tHello from alice\n2021-12-31T00:00:00Z\tOld news\n",
+			})
+			_ = db.PutCachedFeed(&twt.CachedFeed{
+				URL:     "https://stranger.example.com/twtxt.txt",
+				Content: "2022-01-01T13:00:00Z\tNot followed\n",
+			})
+			return db
+		}
+		getTimeline := func(h http.Handler, query string) *httptest.ResponseRecorder {
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/timeline"+query, nil)
+			h.ServeHTTP(res, req)
+			return res
+		}
+
+		t.Run("merges our twts with those of followed feeds", func(t *testing.T) {
+			h := twt.Handler(testhelper.DummyLogger{}, newDB(), twt.NoAuth(), testhelper.NoopEnqueueTask, twt.WithFeedURL("https://example.com/twtxt.txt"))
+			_ = follow(h, `{"nick":"alice","url":"`+alice+`"}`)
+			_ = postStatus(h, status)
+
+			res := getTimeline(h, "")
+
+			require.Equal(t, http.StatusOK, res.Code)
+			var timeline []twt.TimelineTwt
+			require.NoError(t, json.Unmarshal(res.Body.Bytes(), &timeline))
+			require.Len(t, timeline, 3)
+			require.Equal(t, "Hello from alice", timeline[0].Text)
+			require.Equal(t, "alice", timeline[0].Nick)
+			require.Equal(t, twtHash(t, "2022-01-01T12:00:00Z\tHello from alice", alice), timeline[0].Hash)
+			require.Equal(t, "I have a thought", timeline[1].Text)
+			require.Equal(t, "https://example.com/twtxt.txt", timeline[1].URL)
+			require.Equal(t, "Old news", timeline[2].Text)
+		})
+
+		t.Run("limits the timeline", func(t *testing.T) {
+			h := twt.Handler(testhelper.DummyLogger{}, newDB(), twt.NoAuth(), testhelper.NoopEnqueueTask)
+			_ = follow(h, `{"nick":"alice","url":"`+alice+`"}`)
+
+			res := getTimeline(h, "?limit=1")
+
+			var timeline []twt.TimelineTwt
+			require.NoError(t, json.Unmarshal(res.Body.Bytes(), &timeline))
+			require.Len(t, timeline, 1)
+			require.Equal(t, "Hello from alice", timeline[0].Text)
+		})
+
+		t.Run("responds bad request with an invalid limit", func(t *testing.T) {
+			h := twt.Handler(testhelper.DummyLogger{}, newDB(), twt.NoAuth(), testhelper.NoopEnqueueTask)
+
+			require.Equal(t, http.StatusBadRequest, getTimeline(h, "?limit=0").Code)
+		})
+
+		t.Run("requires authentication", func(t *testing.T) {
+			h := twt.Handler(testhelper.DummyLogger{}, newDB(), twt.BasicAuth("user", "password"), testhelper.NoopEnqueueTask)
+
+			require.Equal(t, http.StatusUnauthorized, getTimeline(h, "").Code)
+		})
+	})
+
+	t.Run("mentions", func(t *testing.T) {
+		const ours = "https://example.com/twtxt.txt"
+		newDB := func() *testhelper.FakeDB {
+			db := testhelper.NewFakeDB()
+			_ = db.PutCachedFeed(&twt.CachedFeed{
+				URL:  "https://alice.example.com/twtxt.txt",
+				Nick: "alice",
+				Content: "2022-01-01T12:00:00Z\tHello @<somebody " + ours + ">\n" +
+					"2022-01-01T13:00:00Z\tHello @<bob https://bob.example.com/twtxt.txt>\n" +
+					"2022-01-02T12:00:00Z\t@<somebody " + ours + "> are you there?\n",
+			})
+			return db
+		}
+		getMentions := func(h http.Handler, query string) []twt.TimelineTwt {
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/mentions"+query, nil)
+			h.ServeHTTP(res, req)
+			require.Equal(t, http.StatusOK, res.Code)
+			var mentions []twt.TimelineTwt
+			require.NoError(t, json.Unmarshal(res.Body.Bytes(), &mentions))
+			return mentions
+		}
+
+		t.Run("lists twts mentioning our feed, newest first", func(t *testing.T) {
+			h := twt.Handler(testhelper.DummyLogger{}, newDB(), twt.NoAuth(), testhelper.NoopEnqueueTask, twt.WithFeedURL(ours))
+
+			mentions := getMentions(h, "")
+
+			require.Len(t, mentions, 2)
+			require.Equal(t, "alice", mentions[0].Nick)
+			require.Equal(t, "@<somebody "+ours+"> are you there?", mentions[0].Text)
+			require.Equal(t, "Hello @<somebody "+ours+">", mentions[1].Text)
+		})
+
+		t.Run("matches the url metadata of our feed", func(t *testing.T) {
+			h := twt.Handler(testhelper.DummyLogger{}, newDB(), twt.NoAuth(), testhelper.NoopEnqueueTask)
+			_ = patchMetadata(h, `{"url":["`+ours+`"]}`)
+
+			require.Len(t, getMentions(h, ""), 2)
+		})
+
+		t.Run("drops mentions older than since", func(t *testing.T) {
+			now := func() time.Time { return time.Date(2022, 1, 3, 0, 0, 0, 0, time.UTC) }
+			h := twt.Handler(testhelper.DummyLogger{}, newDB(), twt.NoAuth(), testhelper.NoopEnqueueTask, twt.WithFeedURL(ours), twt.WithClock(now))
+
+			require.Len(t, getMentions(h, "?since=24h"), 1)
+		})
+
+		t.Run("requires authentication", func(t *testing.T) {
+			h := twt.Handler(testhelper.DummyLogger{}, newDB(), twt.BasicAuth("user", "password"), testhelper.NoopEnqueueTask)
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/mentions", nil)
+
+			h.ServeHTTP(res, req)
+
+			require.Equal(t, http.StatusUnauthorized, res.Code)
+		})
+	})
+
+	t.Run("webmention", func(t *testing.T) {
+		const ours = "https://example.com/twtxt.txt"
+		newSource := func(t *testing.T, code int, body string) string {
+			remote := testhelper.NewServer(t, http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+				res.WriteHeader(code)
+				_, _ = fmt.Fprint(res, body)
+			}))
+			return remote + "/twtxt.txt"
+		}
+		sendWebmention := func(h http.Handler, source string, target string) *httptest.ResponseRecorder {
+			res := httptest.NewRecorder()
+			form := url.Values{"source": {source}, "target": {target}}
+			req, _ := http.NewRequest("POST", "/webmention", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			h.ServeHTTP(res, req)
+			return res
+		}
+
+		t.Run("records webmentions whose source links to our feed", func(t *testing.T) {
+			db := testhelper.NewFakeDB()
+			h := twt.Handler(testhelper.DummyLogger{}, db, twt.NoAuth(), testhelper.SyncEnqueueTask, twt.WithFeedURL(ours))
+			source := newSource(t, http.StatusOK, "2022-01-01T00:00:00Z\tHello @<somebody "+ours+">\n")
+
+			res := sendWebmention(h, source, ours)
+
+			require.Equal(t, http.StatusAccepted, res.Code)
+			mentions, _ := db.ListWebmentions()
+			require.Len(t, mentions, 1)
+			require.Equal(t, source, mentions[0].Source)
+			require.Equal(t, ours, mentions[0].Target)
+		})
+
+		t.Run("round trips between two instances", func(t *testing.T) {
+			newInstance := func(t *testing.T) (*testhelper.FakeDB, http.Handler, string, chan struct{}) {
+				db := testhelper.NewFakeDB()
+				mentioned := make(chan struct{}, 1)
+				var h http.Handler
+				remote := testhelper.NewServer(t, http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+					h.ServeHTTP(res, req)
+					if req.Method == http.MethodPost {
+						mentioned <- struct{}{}
+					}
+				}))
+				h = twt.Handler(testhelper.DummyLogger{}, db, twt.NoAuth(), testhelper.SyncEnqueueTask, twt.WithFeedURL(remote+"/twtxt.txt"))
+				return db, h, remote + "/twtxt.txt", mentioned
+			}
+			_, alice, aliceURL, _ := newInstance(t)
+			bobDB, _, bobURL, bobMentioned := newInstance(t)
+
+			res := postStatus(alice, "2022-01-01T00:00:00Z\tHello @<bob "+bobURL+">\n")
+
+			require.Equal(t, http.StatusNoContent, res.Code)
+			<-bobMentioned
+			mentions, _ := bobDB.ListWebmentions()
+			require.Len(t, mentions, 1)
+			require.Equal(t, aliceURL, mentions[0].Source)
+			require.Equal(t, bobURL, mentions[0].Target)
+		})
+
+		t.Run("forgets webmentions whose source no longer links to our feed", func(t *testing.T) {
+			db := testhelper.NewFakeDB()
+			h := twt.Handler(testhelper.DummyLogger{}, db, twt.NoAuth(), testhelper.SyncEnqueueTask, twt.WithFeedURL(ours))
+			source := newSource(t, http.StatusOK, "2022-01-01T00:00:00Z\tHello\n")
+			_ = db.PutWebmention(twt.Webmention{Source: source, Target: ours})
+
+			res := sendWebmention(h, source, ours)
+
+			require.Equal(t, http.StatusAccepted, res.Code)
+			mentions, _ := db.ListWebmentions()
+			require.Empty(t, mentions)
+		})
+
+		t.Run("logs sources that cannot be fetched", func(t *testing.T) {
+			logger := testhelper.NewMockLogger()
+			db := testhelper.NewFakeDB()
+			h := twt.Handler(logger, db, twt.NoAuth(), testhelper.SyncEnqueueTask, twt.WithFeedURL(ours))
+
+			_ = sendWebmention(h, newSource(t, http.StatusInternalServerError, ""), ours)
+
+			require.Len(t, logger.VerifyingWebmentionErrs, 1)
+		})
+
+		t.Run("responds bad request with invalid webmentions", func(t *testing.T) {
+			for name, tc := range map[string]struct{ source, target string }{
+				"invalid source": {"not a url", ours},
+				"invalid target": {"https://other.example.com/twtxt.txt", "ftp://example.com/twtxt.txt"},
+				"same url":       {ours, ours},
+				"other target":   {"https://other.example.com/twtxt.txt", "https://example.com/other.txt"},
+			} {
+				t.Run(name, func(t *testing.T) {
+					h := twt.Handler(testhelper.DummyLogger{}, testhelper.NewFakeDB(), twt.NoAuth(), testhelper.SyncEnqueueTask, twt.WithFeedURL(ours))
+
+					require.Equal(t, http.StatusBadRequest, sendWebmention(h, tc.source, tc.target).Code)
+				})
+			}
+		})
+
+		t.Run("lists webmentions only when authenticated", func(t *testing.T) {
+			db := &testhelper.StubDB{Webmentions: []twt.Webmention{{Source: "https://other.example.com/twtxt.txt", Target: ours}}}
+			list := func(auth twt.Middleware) *httptest.ResponseRecorder {
+				h := twt.Handler(testhelper.DummyLogger{}, db, auth, testhelper.NoopEnqueueTask)
+				res := httptest.NewRecorder()
+				req, _ := http.NewRequest("GET", "/webmention", nil)
+				h.ServeHTTP(res, req)
+				return res
+			}
+
+			res := list(twt.NoAuth())
+
+			require.Equal(t, http.StatusOK, res.Code)
+			var mentions []twt.Webmention
+			require.NoError(t, json.Unmarshal(res.Body.Bytes(), &mentions))
+			require.Equal(t, db.Webmentions, mentions)
+			require.Equal(t, http.StatusUnauthorized, list(twt.BasicAuth("user", "password")).Code)
+		})
+
+		t.Run("sends webmentions for posted statuses", func(t *testing.T) {
+			received := make(chan url.Values, 1)
+			remote := testhelper.NewServer(t, http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+				if req.Method == http.MethodPost {
+					_ = req.ParseForm()
+					received <- req.PostForm
+					return
+				}
+				res.Header().Set("Link", `</webmention>; rel="webmention"`)
+			}))
+			h := twt.Handler(testhelper.DummyLogger{}, testhelper.NewFakeDB(), twt.NoAuth(), testhelper.SyncEnqueueTask, twt.WithFeedURL(ours))
+
+			res := postStatus(h, "2022-01-01T00:00:00Z\tHello @<alice "+remote+"/twtxt.txt> and @<me "+ours+">\n")
+
+			require.Equal(t, http.StatusNoContent, res.Code)
+			require.Equal(t, url.Values{"source": {ours}, "target": {remote + "/twtxt.txt"}}, <-received)
+		})
+
+		t.Run("sends each webmention in its own task", func(t *testing.T) {
+			enqueued := make(chan task.Task, 3)
+			enqueue := func(_ context.Context, task task.Task) error {
+				enqueued <- task
+				return nil
+			}
+			h := twt.Handler(testhelper.DummyLogger{}, testhelper.NewFakeDB(), twt.NoAuth(), enqueue, twt.WithFeedURL(ours))
+
+			_ = postStatus(h, "2022-01-01T00:00:00Z\tHello @<alice https://a.example.com/twtxt.txt> and @<bob https://b.example.com/twtxt.txt>\n")
+
+			require.Eventually(t, func() bool { return len(enqueued) == 2 }, time.Second, time.Millisecond)
+		})
+	})
+
+	t.Run("websub", func(t *testing.T) {
+		const ours = "https://example.com/twtxt.txt"
+		now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+		clock := func() time.Time { return now }
+		type request struct {
+			*http.Request
+			body string
+		}
+		newSubscriber := func(t *testing.T, echo bool) (string, chan request) {
+			requests := make(chan request, 2)
+			remote := testhelper.NewServer(t, http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+				body, _ := io.ReadAll(req.Body)
+				requests <- request{req, string(body)}
+				if echo {
+					_, _ = fmt.Fprint(res, req.URL.Query().Get("hub.challenge"))
+				}
+			}))
+			return remote + "/callback", requests
+		}
+		subscribe := func(h http.Handler, form url.Values) *httptest.ResponseRecorder {
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/hub", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			h.ServeHTTP(res, req)
+			return res
+		}
+
+		t.Run("advertises the hub through link headers", func(t *testing.T) {
+			for name, tc := range map[string]struct {
+				opts []twt.Option
+				hub  string
+			}{
+				"own hub":        {[]twt.Option{twt.WithFeedURL(ours)}, "https://example.com/hub"},
+				"configured hub": {[]twt.Option{twt.WithFeedURL(ours), twt.WithHub("https://hub.example.com/")}, "https://hub.example.com/"},
+			} {
+				t.Run(name, func(t *testing.T) {
+					h := twt.Handler(testhelper.DummyLogger{}, testhelper.EmptyStubDB(), twt.NoAuth(), testhelper.NoopEnqueueTask, tc.opts...)
+					res := httptest.NewRecorder()
+					req, _ := http.NewRequest("GET", "/twtxt.txt", nil)
+
+					h.ServeHTTP(res, req)
+
+					require.Equal(t, []string{`<` + tc.hub + `>; rel="hub"`, `<` + ours + `>; rel="self"`, `<https://example.com/webmention>; rel="webmention"`}, res.Header().Values("Link"))
+				})
+			}
+		})
+
+		t.Run("subscribes after verifying the intent of the subscriber", func(t *testing.T) {
+			db := testhelper.NewFakeDB()
+			h := twt.Handler(testhelper.DummyLogger{}, db, twt.NoAuth(), testhelper.SyncEnqueueTask, twt.WithFeedURL(ours), twt.WithClock(clock))
+			callback, requests := newSubscriber(t, true)
+
+			res := subscribe(h, url.Values{"hub.mode": {"subscribe"}, "hub.topic": {ours}, "hub.callback": {callback}, "hub.lease_seconds": {"3600"}})
+
+			require.Equal(t, http.StatusAccepted, res.Code)
+			require.Len(t, requests, 1)
+			verification := <-requests
+			require.Equal(t, "subscribe", verification.URL.Query().Get("hub.mode"))
+			require.Equal(t, "3600", verification.URL.Query().Get("hub.lease_seconds"))
+			subs, _ := db.ListSubscriptions()
+			require.Equal(t, []twt.Subscription{{Callback: callback, Topic: ours, Expires: now.Add(time.Hour)}}, subs)
+
+			res = subscribe(h, url.Values{"hub.mode": {"unsubscribe"}, "hub.topic": {ours}, "hub.callback": {callback}})
+
+			require.Equal(t, http.StatusAccepted, res.Code)
+			subs, _ = db.ListSubscriptions()
+			require.Empty(t, subs)
+		})
+
+		t.Run("ignores subscribers that do not echo the challenge", func(t *testing.T) {
+			logger := testhelper.NewMockLogger()
+			db := testhelper.NewFakeDB()
+			h := twt.Handler(logger, db, twt.NoAuth(), testhelper.SyncEnqueueTask, twt.WithFeedURL(ours))
+			callback, _ := newSubscriber(t, false)
+
+			_ = subscribe(h, url.Values{"hub.mode": {"subscribe"}, "hub.topic": {ours}, "hub.callback": {callback}})
+
+			subs, _ := db.ListSubscriptions()
+			require.Empty(t, subs)
+			require.Equal(t, []error{twt.ChallengeMismatchErr}, logger.VerifyingSubscriptionErrs)
+		})
+
+		t.Run("responds bad request with invalid subscriptions", func(t *testing.T) {
+			for name, form := range map[string]url.Values{
+				"unknown mode":     {"hub.mode": {"publish"}, "hub.topic": {ours}, "hub.callback": {"https://sub.example.com/"}},
+				"other topic":      {"hub.mode": {"subscribe"}, "hub.topic": {"https://example.com/other.txt"}, "hub.callback": {"https://sub.example.com/"}},
+				"invalid callback": {"hub.mode": {"subscribe"}, "hub.topic": {ours}, "hub.callback": {"mailto:somebody@example.com"}},
+			} {
+				t.Run(name, func(t *testing.T) {
+					h := twt.Handler(testhelper.DummyLogger{}, testhelper.NewFakeDB(), twt.NoAuth(), testhelper.SyncEnqueueTask, twt.WithFeedURL(ours))
+
+					require.Equal(t, http.StatusBadRequest, subscribe(h, form).Code)
+				})
+			}
+		})
+
+		t.Run("delivers the feed to subscribers after posting a status", func(t *testing.T) {
+			db := testhelper.NewFakeDB()
+			callback, requests := newSubscriber(t, false)
+			_ = db.PutSubscription(twt.Subscription{Callback: callback + "?expired", Topic: ours, Expires: now.Add(-time.Hour)})
+			_ = db.PutSubscription(twt.Subscription{Callback: callback, Topic: ours, Secret: "secret", Expires: now.Add(time.Hour)})
+			h := twt.Handler(testhelper.DummyLogger{}, db, twt.NoAuth(), testhelper.SyncEnqueueTask, twt.WithFeedURL(ours), twt.WithClock(clock))
+
+			_ = postStatus(h, status)
+
+			subs, _ := db.ListSubscriptions()
+			require.Len(t, subs, 1)
+			delivery := <-requests
+			require.Empty(t, delivery.URL.RawQuery)
+			require.Equal(t, status, delivery.body)
+			require.Equal(t, `<https://example.com/hub>; rel="hub"`, delivery.Header.Get("Link"))
+			require.Equal(t, "sha256=91e42ac2639f846d5559420c62c61791ab5afb5e846cda08fb768dea170bfd6c", delivery.Header.Get("X-Hub-Signature"))
+		})
+
+		t.Run("delivers the feed to each subscriber in its own task", func(t *testing.T) {
+			db := testhelper.NewFakeDB()
+			_ = db.PutSubscription(twt.Subscription{Callback: "https://a.example.com/callback", Topic: ours, Expires: now.Add(time.Hour)})
+			_ = db.PutSubscription(twt.Subscription{Callback: "https://b.example.com/callback", Topic: ours, Expires: now.Add(time.Hour)})
+			enqueued := make(chan task.Task, 3)
+			enqueue := func(_ context.Context, task task.Task) error {
+				enqueued <- task
+				return nil
+			}
+			h := twt.Handler(testhelper.DummyLogger{}, db, twt.NoAuth(), enqueue, twt.WithFeedURL(ours), twt.WithClock(clock))
+
+			_ = postStatus(h, status)
+
+			require.Eventually(t, func() bool { return len(enqueued) == 2 }, time.Second, time.Millisecond)
+		})
+
+		t.Run("pings the configured hub after posting a status", func(t *testing.T) {
+			hub, requests := newSubscriber(t, false)
+			h := twt.Handler(testhelper.DummyLogger{}, testhelper.NewFakeDB(), twt.NoAuth(), testhelper.SyncEnqueueTask, twt.WithFeedURL(ours), twt.WithHub(hub))
+
+			_ = postStatus(h, status)
+
+			require.Equal(t, url.Values{"hub.mode": {"publish"}, "hub.url": {ours}}.Encode(), (<-requests).body)
+		})
+	})
+
+	t.Run("atom and rss", func(t *testing.T) {
+		const (
+			ours    = "https://example.com/twtxt.txt"
+			long    = "2022-01-02T00:00:00Z\tThis twt goes on and on about nothing in particular until it is far too long for a title\n"
+			mention = "2022-01-03T00:00:00Z\tHello @<alice https://alice.example.com/twtxt.txt>!\n"
+		)
+		newHandler := func() http.Handler {
+			h := twt.Handler(testhelper.DummyLogger{}, testhelper.NewFakeDB(), twt.NoAuth(), testhelper.NoopEnqueueTask, twt.WithFeedURL(ours))
+			_ = patchMetadata(h, `{"nick":["somebody"],"description":["Thoughts"]}`)
+			_ = postStatus(h, status+long+mention)
+			return h
+		}
+		get := func(h http.Handler, path string) *httptest.ResponseRecorder {
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", path, nil)
+			h.ServeHTTP(res, req)
+			return res
+		}
+
+		t.Run("renders twts as atom entries, newest first", func(t *testing.T) {
+			res := get(newHandler(), "/atom.xml")
+
+			require.Equal(t, http.StatusOK, res.Code)
+			require.Equal(t, "application/atom+xml; charset=utf-8", res.Header().Get("Content-Type"))
+			var feed struct {
+				ID      string `xml:"id"`
+				Title   string `xml:"title"`
+				Author  string `xml:"author>name"`
+				Entries []struct {
+					ID      string `xml:"id"`
+					Title   string `xml:"title"`
+					Content string `xml:"content"`
+				} `xml:"entry"`
+			}
+			require.NoError(t, xml.Unmarshal(res.Body.Bytes(), &feed))
+			require.Equal(t, ours, feed.ID)
+			require.Equal(t, "somebody", feed.Title)
+			require.Equal(t, "somebody", feed.Author)
+			require.Len(t, feed.Entries, 3)
+			require.Equal(t, "https://example.com/twts/"+twtHash(t, mention, ours), feed.Entries[0].ID)
+			require.Equal(t, "Hello @alice!", feed.Entries[0].Title)
+			require.Equal(t, "This twt goes on and on about nothing in particular until it is far too long…", feed.Entries[1].Title)
+			require.Equal(t, "I have a thought", feed.Entries[2].Content)
+		})
+
+		t.Run("renders twts as rss items, newest first", func(t *testing.T) {
+			res := get(newHandler(), "/rss.xml")
+
+			require.Equal(t, http.StatusOK, res.Code)
+			require.Equal(t, "application/rss+xml; charset=utf-8", res.Header().Get("Content-Type"))
+			var rss struct {
+				Title       string `xml:"channel>title"`
+				Description string `xml:"channel>description"`
+				Items       []struct {
+					GUID    string `xml:"guid"`
+					Title   string `xml:"title"`
+					PubDate string `xml:"pubDate"`
+					Creator string `xml:"http://purl.org/dc/elements/1.1/ creator"`
+				} `xml:"channel>item"`
+			}
+			require.NoError(t, xml.Unmarshal(res.Body.Bytes(), &rss))
+			require.Equal(t, "somebody", rss.Title)
+			require.Equal(t, "Thoughts", rss.Description)
+			require.Len(t, rss.Items, 3)
+			require.Equal(t, "https://example.com/twts/"+twtHash(t, status, ours), rss.Items[2].GUID)
+			require.Equal(t, "Sat, 01 Jan 2022 00:00:00 +0000", rss.Items[2].PubDate)
+			require.Equal(t, "somebody", rss.Items[2].Creator)
+		})
+
+		t.Run("falls back to a urn and the modification time for an empty feed", func(t *testing.T) {
+			modTime := time.Date(2022, 1, 5, 0, 0, 0, 0, time.UTC)
+			db := &testhelper.StubDB{GetReadCloser: testhelper.NewVersionedReadCloser("# nick = somebody\n", `"v1"`, modTime)}
+			h := twt.Handler(testhelper.DummyLogger{}, db, twt.NoAuth(), testhelper.NoopEnqueueTask)
+
+			res := get(h, "/atom.xml")
+
+			require.Equal(t, http.StatusOK, res.Code)
+			var feed struct {
+				ID      string `xml:"id"`
+				Updated string `xml:"updated"`
+			}
+			require.NoError(t, xml.Unmarshal(res.Body.Bytes(), &feed))
+			require.Equal(t, "urn:twtxt:feed:somebody", feed.ID)
+			require.Equal(t, "2022-01-05T00:00:00Z", feed.Updated)
+		})
+
+		t.Run("supports conditional requests", func(t *testing.T) {
+			h := twt.Handler(testhelper.DummyLogger{}, &versionedMockDB{testhelper.NewMockDB()}, twt.NoAuth(), testhelper.NoopEnqueueTask)
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/atom.xml", nil)
+			req.Header.Set("If-None-Match", `"v1-atom"`)
+
+			h.ServeHTTP(res, req)
+
+			require.Equal(t, http.StatusNotModified, res.Code)
+		})
+	})
+
+	t.Run("json", func(t *testing.T) {
+		const (
+			ours    = "https://example.com/twtxt.txt"
+			mention = "2022-01-02T00:00:00Z\tHello @<alice https://alice.example.com/twtxt.txt> #twtxt\n"
+			same    = "2022-01-02T00:00:00Z\tSame time\n"
+			last    = "2022-01-03T00:00:00Z\tLast\n"
+		)
+		newHandler := func() http.Handler {
+			h := twt.Handler(testhelper.DummyLogger{}, testhelper.NewFakeDB(), twt.NoAuth(), testhelper.NoopEnqueueTask, twt.WithFeedURL(ours))
+			_ = patchMetadata(h, `{"nick":["somebody"]}`)
+			_ = postStatus(h, status+mention+same+last)
+			return h
+		}
+		get := func(h http.Handler, path string) *httptest.ResponseRecorder {
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", path, nil)
+			h.ServeHTTP(res, req)
+			return res
+		}
+		type page struct {
+			Twts []struct {
+				Hash     string                   `json:"hash"`
+				Created  time.Time                `json:"created"`
+				Text     string                   `json:"text"`
+				Mentions []map[string]interface{} `json:"mentions"`
+			} `json:"twts"`
+			Next string `json:"next"`
+		}
+		getPage := func(h http.Handler, path string) page {
+			res := get(h, path)
+			require.Equal(t, http.StatusOK, res.Code)
+			var p page
+			require.NoError(t, json.Unmarshal(res.Body.Bytes(), &p))
+			return p
+		}
+
+		t.Run("renders twts as json feed items", func(t *testing.T) {
+			res := get(newHandler(), "/feed.json")
+
+			require.Equal(t, http.StatusOK, res.Code)
+			require.Equal(t, "application/feed+json; charset=utf-8", res.Header().Get("Content-Type"))
+			var feed struct {
+				Version string `json:"version"`
+				Title   string `json:"title"`
+				Items   []struct {
+					ID          string   `json:"id"`
+					ContentText string   `json:"content_text"`
+					Tags        []string `json:"tags"`
+					Twtxt       struct {
+						Hash string `json:"hash"`
+					} `json:"_twtxt"`
+				} `json:"items"`
+			}
+			require.NoError(t, json.Unmarshal(res.Body.Bytes(), &feed))
+			require.Equal(t, "https://jsonfeed.org/version/1.1", feed.Version)
+			require.Equal(t, "somebody", feed.Title)
+			require.Len(t, feed.Items, 4)
+			require.Equal(t, "https://example.com/twts/"+twtHash(t, mention, ours), feed.Items[2].ID)
+			require.Equal(t, twtHash(t, mention, ours), feed.Items[2].Twtxt.Hash)
+			require.Equal(t, "Hello @alice #twtxt", feed.Items[2].ContentText)
+			require.Equal(t, []string{"twtxt"}, feed.Items[2].Tags)
+		})
+
+		t.Run("lists twts with their hashes and mentions", func(t *testing.T) {
+			p := getPage(newHandler(), "/api/twts")
+
+			require.Len(t, p.Twts, 4)
+			require.Empty(t, p.Next)
+			require.Equal(t, "I have a thought", p.Twts[0].Text)
+			require.Equal(t, twtHash(t, mention, ours), p.Twts[1].Hash)
+			require.Equal(t, []map[string]interface{}{{"nick": "alice", "url": "https://alice.example.com/twtxt.txt"}}, p.Twts[1].Mentions)
+		})
+
+		t.Run("pages through twts without splitting a timestamp", func(t *testing.T) {
+			h := newHandler()
+
+			first := getPage(h, "/api/twts?limit=2")
+			require.Len(t, first.Twts, 3)
+			require.Equal(t, "/api/twts?limit=2&since=2022-01-02T00%3A00%3A00Z", first.Next)
+
+			second := getPage(h, first.Next)
+			require.Len(t, second.Twts, 1)
+			require.Equal(t, "Last", second.Twts[0].Text)
+			require.Empty(t, second.Next)
+		})
+
+		t.Run("serves pages without validators", func(t *testing.T) {
+			db := &testhelper.StubDB{GetReadCloser: testhelper.NewVersionedReadCloser(status, `"v1"`, time.Date(2022, 1, 5, 0, 0, 0, 0, time.UTC))}
+			h := twt.Handler(testhelper.DummyLogger{}, db, twt.NoAuth(), testhelper.NoopEnqueueTask)
+
+			res := get(h, "/api/twts?since=24h")
+
+			require.Equal(t, http.StatusOK, res.Code)
+			require.Empty(t, res.Header().Get("ETag"))
+			require.Empty(t, res.Header().Get("Last-Modified"))
+		})
+
+		t.Run("responds bad request with invalid parameters", func(t *testing.T) {
+			h := newHandler()
+
+			require.Equal(t, http.StatusBadRequest, get(h, "/api/twts?limit=-1").Code)
+			require.Equal(t, http.StatusBadRequest, get(h, "/api/twts?since=yesterday").Code)
+		})
+	})
+
+	t.Run("profile", func(t *testing.T) {
+		getProfile := func(h http.Handler) *httptest.ResponseRecorder {
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/", nil)
+			h.ServeHTTP(res, req)
+			return res
+		}
+
+		t.Run("renders metadata and twts as html", func(t *testing.T) {
+			h := twt.Handler(testhelper.DummyLogger{}, testhelper.NewFakeDB(), twt.NoAuth(), testhelper.NoopEnqueueTask, twt.WithFeedURL("https://example.com/twtxt.txt"))
+			_ = patchMetadata(h, `{"nick":["somebody"],"avatar":["https://example.com/avatar.png"],"description":["<b>Thoughts</b>"]}`)
+			_ = postStatus(h, "2022-01-01T00:00:00Z\tHi @<alice https://alice.example.com/twtxt.txt>, see https://example.com/post. <script>\u2028Bye\n")
+
+			res := getProfile(h)
+
+			require.Equal(t, http.StatusOK, res.Code)
+			require.Equal(t, "text/html; charset=utf-8", res.Header().Get("Content-Type"))
+			body := res.Body.String()
+			require.Contains(t, body, `<title>somebody</title>`)
+			require.Contains(t, body, `<link rel="alternate" type="text/plain" title="twtxt" href="twtxt.txt">`)
+			require.Contains(t, body, `<link rel="webmention" href="webmention">`)
+			require.Contains(t, body, `<img src="https://example.com/avatar.png" alt="">`)
+			require.Contains(t, body, `<p>&lt;b&gt;Thoughts&lt;/b&gt;</p>`)
+			require.Contains(t, body, `Hi <a href="https://alice.example.com/twtxt.txt">@alice</a>, see <a href="https://example.com/post">https://example.com/post</a>. &lt;script&gt;<br>Bye`)
+			require.NotContains(t, body, "<script>")
+		})
+
+		t.Run("renders an empty feed", func(t *testing.T) {
+			h := twt.Handler(testhelper.DummyLogger{}, testhelper.NewFakeDB(), twt.NoAuth(), testhelper.NoopEnqueueTask)
+
+			res := getProfile(h)
+
+			require.Equal(t, http.StatusOK, res.Code)
+			require.Contains(t, res.Body.String(), "No twts yet.")
+		})
+	})
+
+	t.Run("compose", func(t *testing.T) {
+		now := func() time.Time { return time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC) }
+		getCompose := func(h http.Handler) (*httptest.ResponseRecorder, *http.Cookie) {
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/compose", nil)
+			h.ServeHTTP(res, req)
+			cookies := res.Result().Cookies()
+			require.Len(t, cookies, 1)
+			return res, cookies[0]
+		}
+		postCompose := func(h http.Handler, cookie *http.Cookie, form url.Values) *httptest.ResponseRecorder {
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/compose", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if cookie != nil {
+				req.AddCookie(cookie)
+			}
+			h.ServeHTTP(res, req)
+			return res
+		}
+
+		t.Run("serves the form with a csrf token", func(t *testing.T) {
+			h := twt.Handler(testhelper.DummyLogger{}, testhelper.NewFakeDB(), twt.NoAuth(), testhelper.NoopEnqueueTask)
+
+			res, cookie := getCompose(h)
+
+			require.Equal(t, http.StatusOK, res.Code)
+			require.Equal(t, http.SameSiteStrictMode, cookie.SameSite)
+			require.True(t, cookie.HttpOnly)
+			require.Contains(t, res.Body.String(), `<input type="hidden" name="csrf_token" value="`+cookie.Value+`">`)
+		})
+
+		t.Run("posts the status through the database", func(t *testing.T) {
+			h := twt.Handler(testhelper.DummyLogger{}, testhelper.NewFakeDB(), twt.NoAuth(), testhelper.NoopEnqueueTask, twt.WithClock(now))
+			_, cookie := getCompose(h)
+
+			res := postCompose(h, cookie, url.Values{"csrf_token": {cookie.Value}, "text": {"First line\r\nSecond line\r\n"}, "action": {"post"}})
+
+			require.Equal(t, http.StatusSeeOther, res.Code)
+			require.Equal(t, "2022-01-01T00:00:00Z\tFirst line\u2028Second line\n", getTwtxt(h))
+		})
+
+		t.Run("previews the status line without posting it", func(t *testing.T) {
+			h := twt.Handler(testhelper.DummyLogger{}, testhelper.NewFakeDB(), twt.NoAuth(), testhelper.NoopEnqueueTask, twt.WithClock(now))
+			_, cookie := getCompose(h)
+
+			res := postCompose(h, cookie, url.Values{"csrf_token": {cookie.Value}, "text": {"Hello"}, "action": {"preview"}})
+
+			require.Equal(t, http.StatusOK, res.Code)
+			require.Contains(t, res.Body.String(), "<pre id=\"preview\">2022-01-01T00:00:00Z\tHello</pre>")
+			require.Contains(t, res.Body.String(), `<span id="count">5</span>`)
+			require.Empty(t, getTwtxt(h))
+		})
+
+		t.Run("rejects posts without a matching csrf token", func(t *testing.T) {
+			h := twt.Handler(testhelper.DummyLogger{}, testhelper.NewFakeDB(), twt.NoAuth(), testhelper.NoopEnqueueTask)
+			_, cookie := getCompose(h)
+
+			require.Equal(t, http.StatusForbidden, postCompose(h, nil, url.Values{"csrf_token": {cookie.Value}, "text": {"Hello"}}).Code)
+			require.Equal(t, http.StatusForbidden, postCompose(h, cookie, url.Values{"csrf_token": {"forged"}, "text": {"Hello"}}).Code)
+			require.Empty(t, getTwtxt(h))
+		})
+
+		t.Run("shows an error for empty statuses", func(t *testing.T) {
+			h := twt.Handler(testhelper.DummyLogger{}, testhelper.NewFakeDB(), twt.NoAuth(), testhelper.NoopEnqueueTask)
+			_, cookie := getCompose(h)
+
+			res := postCompose(h, cookie, url.Values{"csrf_token": {cookie.Value}, "text": {"  "}})
+
+			require.Equal(t, http.StatusBadRequest, res.Code)
+			require.Contains(t, res.Body.String(), `<p class="error">missing text</p>`)
+		})
+
+		t.Run("requires authentication", func(t *testing.T) {
+			h := twt.Handler(testhelper.DummyLogger{}, testhelper.NewFakeDB(), twt.BasicAuth("user", "password"), testhelper.NoopEnqueueTask)
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/compose", nil)
+
+			h.ServeHTTP(res, req)
+
+			require.Equal(t, http.StatusUnauthorized, res.Code)
+			require.Equal(t, `Basic realm="twtd", charset="UTF-8"`, res.Header().Get("WWW-Authenticate"))
+		})
+	})
+
+	t.Run("micropub", func(t *testing.T) {
+		const ours = "https://example.com/twtxt.txt"
+		now := func() time.Time { return time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC) }
+		newHandler := func() http.Handler {
+			return twt.Handler(testhelper.DummyLogger{}, testhelper.NewFakeDB(), twt.BasicAuth("user", "password"), testhelper.NoopEnqueueTask,
+				twt.WithFeedURL(ours), twt.WithClock(now), twt.WithMicropubToken("token"))
+		}
+		micropub := func(h http.Handler, method string, contentType string, body string) *httptest.ResponseRecorder {
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest(method, "/micropub", strings.NewReader(body))
+			if method == "GET" {
+				req.URL.RawQuery = body
+			}
+			req.Header.Set("Content-Type", contentType)
+			req.Header.Set("Authorization", "Bearer token")
+			h.ServeHTTP(res, req)
+			return res
+		}
+		const line = "2022-01-01T00:00:00Z\tHello Micropub\n"
+
+		t.Run("creates twts from form-encoded h-entries", func(t *testing.T) {
+			h := newHandler()
+
+			res := micropub(h, "POST", "application/x-www-form-urlencoded", "h=entry&content=Hello+Micropub")
+
+			require.Equal(t, http.StatusCreated, res.Code)
+			require.Equal(t, "https://example.com/twts/"+twtHash(t, line, ours), res.Header().Get("Location"))
+			require.Equal(t, line, getTwtxt(h))
+		})
+
+		t.Run("creates h-entries from forms without h", func(t *testing.T) {
+			h := newHandler()
+
+			res := micropub(h, "POST", "application/x-www-form-urlencoded", "content=Hello+Micropub")
+
+			require.Equal(t, http.StatusCreated, res.Code)
+			require.Equal(t, line, getTwtxt(h))
+		})
+
+		t.Run("creates twts from json h-entries", func(t *testing.T) {
+			for name, content := range map[string]string{
+				"text":   `"Hello Micropub"`,
+				"object": `{"html":"<p>Hello <b>Micropub</b></p>"}`,
+			} {
+				t.Run(name, func(t *testing.T) {
+					h := newHandler()
+
+					res := micropub(h, "POST", "application/json", `{"type":["h-entry"],"properties":{"content":[`+content+`]}}`)
+
+					require.Equal(t, http.StatusCreated, res.Code)
+					require.Equal(t, line, getTwtxt(h))
+				})
+			}
+		})
+
+		t.Run("deletes twts by their permalink", func(t *testing.T) {
+			h := newHandler()
+			_ = micropub(h, "POST", "application/x-www-form-urlencoded", "h=entry&content=Hello+Micropub")
+			permalink := "https://example.com/twts/" + twtHash(t, line, ours)
+
+			res := micropub(h, "POST", "application/json", `{"action":"delete","url":"`+permalink+`"}`)
+
+			require.Equal(t, http.StatusNoContent, res.Code)
+			require.Empty(t, getTwtxt(h))
+			res = micropub(h, "POST", "application/x-www-form-urlencoded", url.Values{"action": {"delete"}, "url": {permalink}}.Encode())
+			require.Equal(t, http.StatusBadRequest, res.Code)
+			require.JSONEq(t, `{"error":"invalid_request","error_description":"twt not found"}`, res.Body.String())
+		})
+
+		t.Run("answers config queries", func(t *testing.T) {
+			res := micropub(newHandler(), "GET", "", "q=config")
+
+			require.Equal(t, http.StatusOK, res.Code)
+			require.JSONEq(t, `{"syndicate-to":[],"post-types":[{"type":"note","name":"Twt"}]}`, res.Body.String())
+		})
+
+		t.Run("responds bad request with unsupported requests", func(t *testing.T) {
+			h := newHandler()
+
+			require.Equal(t, http.StatusBadRequest, micropub(h, "POST", "application/x-www-form-urlencoded", "h=event&content=Party").Code)
+			require.Equal(t, http.StatusBadRequest, micropub(h, "POST", "application/x-www-form-urlencoded", "action=undelete&url="+ours).Code)
+			require.Equal(t, http.StatusBadRequest, micropub(h, "POST", "application/x-www-form-urlencoded", "h=entry").Code)
+			require.Equal(t, http.StatusBadRequest, micropub(h, "GET", "", "q=source").Code)
+		})
+
+		t.Run("authenticates with the token or basic auth", func(t *testing.T) {
+			h := newHandler()
+			request := func(configure func(req *http.Request)) int {
+				res := httptest.NewRecorder()
+				req, _ := http.NewRequest("GET", "/micropub?q=config", nil)
+				configure(req)
+				h.ServeHTTP(res, req)
+				return res.Code
+			}
+
+			require.Equal(t, http.StatusOK, request(func(req *http.Request) { req.URL.RawQuery += "&access_token=token" }))
+			require.Equal(t, http.StatusOK, request(func(req *http.Request) { req.SetBasicAuth("user", "password") }))
+			require.Equal(t, http.StatusForbidden, request(func(req *http.Request) { req.Header.Set("Authorization", "Bearer forged") }))
+			require.Equal(t, http.StatusUnauthorized, request(func(req *http.Request) {}))
+		})
+
+		t.Run("authenticates with indieauth access tokens", func(t *testing.T) {
+			tokens := map[string]string{
+				"valid":      `{"me":"https://example.com/","client_id":"https://quill.p3k.io/","scope":"create"}`,
+				"other site": `{"me":"https://other.example.com/","scope":"create"}`,
+				"read only":  `{"me":"https://example.com","scope":"read"}`,
+			}
+			tokenEndpoint := testhelper.NewServer(t, http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+				info, ok := tokens[strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")]
+				if !ok {
+					res.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				res.Header().Set("Content-Type", "application/json")
+				_, _ = fmt.Fprint(res, info)
+			}))
+			h := twt.Handler(testhelper.DummyLogger{}, testhelper.NewFakeDB(), twt.BasicAuth("user", "password"), testhelper.NoopEnqueueTask,
+				twt.WithFeedURL(ours), twt.WithClock(now), twt.WithIndieAuth("https://indieauth.example.com/auth", tokenEndpoint))
+			request := func(token string) int {
+				res := httptest.NewRecorder()
+				req, _ := http.NewRequest("POST", "/micropub", strings.NewReader("content=Hello+Micropub"))
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+				req.Header.Set("Authorization", "Bearer "+token)
+				h.ServeHTTP(res, req)
+				return res.Code
+			}
+
+			require.Equal(t, http.StatusForbidden, request("other site"))
+			require.Equal(t, http.StatusForbidden, request("read only"))
+			require.Equal(t, http.StatusForbidden, request("revoked"))
+			require.Equal(t, http.StatusCreated, request("valid"))
+			require.Equal(t, line, getTwtxt(h))
+		})
+
+		t.Run("advertises the indieauth endpoints on the profile", func(t *testing.T) {
+			h := twt.Handler(testhelper.DummyLogger{}, testhelper.NewFakeDB(), twt.NoAuth(), testhelper.NoopEnqueueTask,
+				twt.WithFeedURL(ours), twt.WithIndieAuth("https://indieauth.example.com/auth", "https://indieauth.example.com/token"))
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/", nil)
+
+			h.ServeHTTP(res, req)
+
+			require.Equal(t, []string{
+				`<https://indieauth.example.com/auth>; rel="authorization_endpoint"`,
+				`<https://indieauth.example.com/token>; rel="token_endpoint"`,
+			}, res.Header().Values("Link"))
+		})
+	})
+
+	t.Run("posted statuses can be read back", func(t *testing.T) {
+		h := twt.Handler(testhelper.DummyLogger{}, testhelper.NewFakeDB(), twt.NoAuth(), testhelper.NoopEnqueueTask)
+
+		_ = postStatus(h, status)
+		twtxt := getTwtxt(h)
+
+		require.Equal(t, status, twtxt)
+	})
+}
+
+func getTwtxt(h http.Handler) string {
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/twtxt.txt", nil)
+	h.ServeHTTP(res, req)
+	buf := bytes.NewBuffer(nil)
+	_, _ = io.Copy(buf, res.Body)
+	return buf.String()
+}
+
+func postStatus(h http.Handler, status string) *httptest.ResponseRecorder {
+	res := httptest.NewRecorder()
+	buf := bytes.NewBufferString(status)
+	req, _ := http.NewRequest("PATCH", "/twtxt.txt", buf)
+	req.Header.Set("Content-Type", "text/vnd.twtxt+plain")
+	h.ServeHTTP(res, req)
+	return res
+}
+
+func postStatusText(h http.Handler, contentType string, text string) *httptest.ResponseRecorder {
+	res := httptest.NewRecorder()
+	buf := bytes.NewBufferString(text)
+	req, _ := http.NewRequest("PATCH", "/twtxt.txt?timestamp=server", buf)
+	req.Header.Set("Content-Type", contentType)
+	h.ServeHTTP(res, req)
+	return res
+}
+
+func patchMetadata(h http.Handler, body string) *httptest.ResponseRecorder {
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("PATCH", "/metadata", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	h.ServeHTTP(res, req)
+	return res
+}
+
+func follow(h http.Handler, body string) *httptest.ResponseRecorder {
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/following", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	h.ServeHTTP(res, req)
+	return res
+}
+
+func unfollow(h http.Handler, url string) *httptest.ResponseRecorder {
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("DELETE", "/following?url="+url, nil)
+	h.ServeHTTP(res, req)
+	return res
+}
+
+func deleteTwt(h http.Handler, id string) *httptest.ResponseRecorder {
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("DELETE", "/twts/"+id, nil)
+	h.ServeHTTP(res, req)
+	return res
+}
+
+func putTwt(h http.Handler, id string, contentType string, text string) *httptest.ResponseRecorder {
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("PUT", "/twts/"+id, bytes.NewBufferString(text))
+	req.Header.Set("Content-Type", contentType)
+	h.ServeHTTP(res, req)
+	return res
+}
+
+func getTwt(h http.Handler, id string) *httptest.ResponseRecorder {
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/twts/"+id, nil)
+	h.ServeHTTP(res, req)
+	return res
+}
+
+func twtHash(t *testing.T, line string, feedURL string) string {
+	parsed, err := twtxt.ParseTwt(line)
+	require.NoError(t, err)
+	return parsed.Hash(feedURL)
+}
+
+type versionedMockDB struct {
+	*testhelper.MockDB
+}
+
+func (db *versionedMockDB) Get() (io.ReadCloser, error) {
+	return testhelper.NewVersionedReadCloser(status, `"v1"`, time.Time{}), nil
+}
+
+func gzipString(t *testing.T, s string) []byte {
+	buf := bytes.NewBuffer(nil)
+	zw := gzip.NewWriter(buf)
+	_, err := zw.Write([]byte(s))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
 }
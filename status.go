@@ -0,0 +1,70 @@
+package twt
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/m25n/twt/twtxt"
+	"time"
+)
+
+// maxStatusSize bounds the body of a request posting a status.
+const maxStatusSize = 1 << 20
+
+type InvalidStatusErr struct {
+	Line   int
+	Reason string
+}
+
+func (e *InvalidStatusErr) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Reason)
+}
+
+func ValidateStatus(status []byte) error {
+	if len(status) == 0 {
+		return &InvalidStatusErr{Line: 1, Reason: "status is empty"}
+	}
+	lines := bytes.SplitAfter(status, []byte("\n"))
+	for i, line := range lines {
+		if len(line) == 0 {
+			continue
+		}
+		if err := validateStatusLine(line); err != nil {
+			return &InvalidStatusErr{Line: i + 1, Reason: err.Error()}
+		}
+	}
+	return nil
+}
+
+func timestampStatus(now time.Time, text []byte) ([]byte, error) {
+	text, err := statusText(text)
+	if err != nil {
+		return nil, err
+	}
+	status := make([]byte, 0, len(time.RFC3339)+len(text)+2)
+	status = append(status, now.Format(time.RFC3339)...)
+	status = append(status, '\t')
+	status = append(status, text...)
+	return append(status, '\n'), nil
+}
+
+func statusText(text []byte) ([]byte, error) {
+	text = bytes.TrimSuffix(bytes.TrimSuffix(text, []byte("\n")), []byte("\r"))
+	if bytes.ContainsAny(text, "\r\n") {
+		return nil, fmt.Errorf("status text must be a single line")
+	}
+	if len(bytes.TrimSpace(text)) == 0 {
+		return nil, twtxt.MissingTextErr
+	}
+	return text, nil
+}
+
+func validateStatusLine(line []byte) error {
+	if line[len(line)-1] != '\n' {
+		return fmt.Errorf("missing trailing newline")
+	}
+	if bytes.ContainsRune(bytes.TrimSuffix(line[:len(line)-1], []byte("\r")), '\r') {
+		return fmt.Errorf("unexpected carriage return")
+	}
+	_, err := twtxt.ParseTwt(string(line))
+	return err
+}
@@ -0,0 +1,183 @@
+package twt
+
+import (
+	"bytes"
+	"encoding/xml"
+	"net/url"
+	"time"
+)
+
+type atomFeed struct {
+	XMLName  xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID       string      `xml:"id"`
+	Title    string      `xml:"title"`
+	Subtitle string      `xml:"subtitle,omitempty"`
+	Updated  string      `xml:"updated"`
+	Icon     string      `xml:"icon,omitempty"`
+	Links    []atomLink  `xml:"link"`
+	Author   atomAuthor  `xml:"author"`
+	Entries  []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+	URI  string `xml:"uri,omitempty"`
+}
+
+type atomEntry struct {
+	ID        string     `xml:"id"`
+	Title     string     `xml:"title"`
+	Published string     `xml:"published"`
+	Updated   string     `xml:"updated"`
+	Links     []atomLink `xml:"link"`
+	Content   atomText   `xml:"content"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr"`
+	Text string `xml:",chardata"`
+}
+
+// renderAtom identifies entries by their permalink, which stays stable as
+// long as the twt does.
+func renderAtom(v *feedView) ([]byte, error) {
+	feed := atomFeed{
+		ID:       feedID(v),
+		Title:    v.Title(),
+		Subtitle: v.Description,
+		Updated:  v.Updated.Format(time.RFC3339),
+		Icon:     v.Avatar,
+		Author:   atomAuthor{Name: v.Title(), URI: v.URL},
+	}
+	if v.URL != "" {
+		feed.Links = []atomLink{
+			{Rel: "self", Type: "application/atom+xml", Href: siteURL(v.URL, "atom.xml")},
+			{Rel: "alternate", Type: "text/plain", Href: v.URL},
+		}
+	}
+	for _, t := range v.Twts {
+		entry := atomEntry{
+			ID:        entryID(v, t),
+			Title:     twtTitle(t.Text),
+			Published: t.Created.Format(time.RFC3339),
+			Updated:   t.Created.Format(time.RFC3339),
+			Content:   atomText{Type: "text", Text: plainText(t.Text)},
+		}
+		if t.Permalink != "" {
+			entry.Links = []atomLink{{Rel: "alternate", Href: t.Permalink}}
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+	return marshalXML(feed)
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Atom    string     `xml:"xmlns:atom,attr"`
+	DC      string     `xml:"xmlns:dc,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	Self          *rssSelf  `xml:"atom:link,omitempty"`
+	Items         []rssItem `xml:"item"`
+	Image         *rssImage `xml:"image,omitempty"`
+}
+
+type rssSelf struct {
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+	Href string `xml:"href,attr"`
+}
+
+type rssImage struct {
+	URL   string `xml:"url"`
+	Title string `xml:"title"`
+	Link  string `xml:"link"`
+}
+
+type rssItem struct {
+	GUID        rssGUID `xml:"guid"`
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link,omitempty"`
+	Description string  `xml:"description"`
+	PubDate     string  `xml:"pubDate"`
+	Creator     string  `xml:"dc:creator"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Text        string `xml:",chardata"`
+}
+
+func renderRSS(v *feedView) ([]byte, error) {
+	channel := rssChannel{
+		Title:       v.Title(),
+		Link:        v.URL,
+		Description: v.Description,
+	}
+	if channel.Description == "" {
+		channel.Description = "twtxt feed of " + v.Title()
+	}
+	if !v.Updated.IsZero() {
+		channel.LastBuildDate = v.Updated.Format(time.RFC1123Z)
+	}
+	if v.URL != "" {
+		channel.Self = &rssSelf{Rel: "self", Type: "application/rss+xml", Href: siteURL(v.URL, "rss.xml")}
+	}
+	if v.Avatar != "" {
+		channel.Image = &rssImage{URL: v.Avatar, Title: v.Title(), Link: v.URL}
+	}
+	for _, t := range v.Twts {
+		channel.Items = append(channel.Items, rssItem{
+			GUID:        rssGUID{IsPermaLink: t.Permalink != "", Text: entryID(v, t)},
+			Title:       twtTitle(t.Text),
+			Link:        t.Permalink,
+			Description: plainText(t.Text),
+			PubDate:     t.Created.Format(time.RFC1123Z),
+			Creator:     v.Title(),
+		})
+	}
+	return marshalXML(rssFeed{
+		Version: "2.0",
+		Atom:    "http://www.w3.org/2005/Atom",
+		DC:      "http://purl.org/dc/elements/1.1/",
+		Channel: channel,
+	})
+}
+
+func feedID(v *feedView) string {
+	if v.URL != "" {
+		return v.URL
+	}
+	return "urn:twtxt:feed:" + url.PathEscape(v.Title())
+}
+
+func entryID(v *feedView, t twtView) string {
+	if t.Permalink != "" {
+		return t.Permalink
+	}
+	return "urn:twtxt:" + t.Hash
+}
+
+func marshalXML(v interface{}) ([]byte, error) {
+	buf := bytes.NewBufferString(xml.Header)
+	enc := xml.NewEncoder(buf)
+	enc.Indent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
@@ -68,3 +68,28 @@ func (w *worker) loop() {
 func (w *worker) Stop() {
 	w.stop <- struct{}{}
 }
+
+// Inline is an EnqueueFunc that runs task on the calling goroutine. Tasks that
+// only enqueue further tasks run inline, so they never hold a worker while
+// waiting for another one.
+func Inline(ctx context.Context, task Task) error {
+	task(ctx)
+	return nil
+}
+
+// Every enqueues task each interval until ctx is done. A tick is skipped when
+// no worker picks the task up before the next one is due.
+func Every(ctx context.Context, interval time.Duration, enqueue EnqueueFunc, task Task) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			enqueueCtx, cancel := context.WithTimeout(ctx, interval)
+			_ = enqueue(enqueueCtx, task)
+			cancel()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
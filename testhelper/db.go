@@ -2,16 +2,22 @@ package testhelper
 
 import (
 	"bytes"
+	"github.com/m25n/twt"
+	"github.com/m25n/twt/twtxt"
 	"io"
+	"time"
 )
 
 type FakeDB struct {
-	statusLines []string
-	followers   []string
+	statusLines   []string
+	followers     []string
+	feeds         map[string]*twt.CachedFeed
+	webmentions   []twt.Webmention
+	subscriptions []twt.Subscription
 }
 
 func NewFakeDB() *FakeDB {
-	return &FakeDB{}
+	return &FakeDB{feeds: map[string]*twt.CachedFeed{}}
 }
 
 func (db *FakeDB) Get() (io.ReadCloser, error) {
@@ -32,18 +38,136 @@ func (db *FakeDB) PostStatus(statusLine io.Reader) error {
 	return nil
 }
 
+func (db *FakeDB) Rewrite(fn func(*twtxt.Feed) error) error {
+	content, _ := db.Get()
+	feed, err := twtxt.ParseLenient(content)
+	if err != nil {
+		return err
+	}
+	if err := fn(feed); err != nil {
+		return err
+	}
+	buf := bytes.NewBuffer(nil)
+	_, _ = feed.WriteTo(buf)
+	db.statusLines = []string{buf.String()}
+	return nil
+}
+
+func (db *FakeDB) ListFollowers() ([]twt.FollowerRecord, error) {
+	return nil, nil
+}
+
+func (db *FakeDB) SetFollowerVerification(_ string, _ string, _ string, _ time.Time) error {
+	return nil
+}
+
+func (db *FakeDB) GetCachedFeed(url string) (*twt.CachedFeed, error) {
+	feed, ok := db.feeds[url]
+	if !ok {
+		return nil, nil
+	}
+	cached := *feed
+	return &cached, nil
+}
+
+func (db *FakeDB) PutCachedFeed(feed *twt.CachedFeed) error {
+	cached := *feed
+	db.feeds[feed.URL] = &cached
+	return nil
+}
+
+func (db *FakeDB) ListCachedFeeds() ([]*twt.CachedFeed, error) {
+	feeds := make([]*twt.CachedFeed, 0, len(db.feeds))
+	for _, feed := range db.feeds {
+		feeds = append(feeds, feed)
+	}
+	return feeds, nil
+}
+
+func (db *FakeDB) PutWebmention(mention twt.Webmention) error {
+	_ = db.DeleteWebmention(mention.Source, mention.Target)
+	db.webmentions = append(db.webmentions, mention)
+	return nil
+}
+
+func (db *FakeDB) DeleteWebmention(source string, target string) error {
+	for i, m := range db.webmentions {
+		if m.Source == source && m.Target == target {
+			db.webmentions = append(db.webmentions[:i], db.webmentions[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (db *FakeDB) ListWebmentions() ([]twt.Webmention, error) {
+	return append([]twt.Webmention(nil), db.webmentions...), nil
+}
+
+func (db *FakeDB) PutSubscription(sub twt.Subscription) error {
+	_ = db.DeleteSubscription(sub.Callback)
+	db.subscriptions = append(db.subscriptions, sub)
+	return nil
+}
+
+func (db *FakeDB) DeleteSubscription(callback string) error {
+	for i, sub := range db.subscriptions {
+		if sub.Callback == callback {
+			db.subscriptions = append(db.subscriptions[:i], db.subscriptions[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (db *FakeDB) ListSubscriptions() ([]twt.Subscription, error) {
+	return append([]twt.Subscription(nil), db.subscriptions...), nil
+}
+
+func (db *FakeDB) GetArchive(_ string) (io.ReadCloser, error) {
+	return nil, twt.ArchiveNotFoundErr
+}
+
 func (db *FakeDB) LogFollower(follower string) error {
 	db.followers = append(db.followers, follower)
 	return nil
 }
 
+func (db *FakeDB) LogListFollowers(_ *twt.MultiFollower, followers []*twt.SingleFollower) error {
+	for _, follower := range followers {
+		db.followers = append(db.followers, follower.String())
+	}
+	return nil
+}
+
 type StubDB struct {
 	GetReadCloser io.ReadCloser
 	GetErr        error
 
 	PostStatusErr error
 
+	RewriteErr error
+
+	GetArchiveReadCloser io.ReadCloser
+	GetArchiveErr        error
+
 	LogFollowerErr error
+
+	LogListFollowersErr error
+
+	FollowerRecords []twt.FollowerRecord
+	FollowersErr    error
+
+	SetFollowerVerificationErr error
+
+	CachedFeed    *twt.CachedFeed
+	CachedFeedErr error
+
+	Webmentions   []twt.Webmention
+	WebmentionErr error
+
+	Subscriptions   []twt.Subscription
+	SubscriptionErr error
 }
 
 func EmptyStubDB() *StubDB {
@@ -60,17 +184,83 @@ func (db *StubDB) PostStatus(_ io.Reader) error {
 	return db.PostStatusErr
 }
 
+func (db *StubDB) Rewrite(_ func(*twtxt.Feed) error) error {
+	return db.RewriteErr
+}
+
+func (db *StubDB) ListFollowers() ([]twt.FollowerRecord, error) {
+	return db.FollowerRecords, db.FollowersErr
+}
+
+func (db *StubDB) SetFollowerVerification(_ string, _ string, _ string, _ time.Time) error {
+	return db.SetFollowerVerificationErr
+}
+
+func (db *StubDB) GetCachedFeed(_ string) (*twt.CachedFeed, error) {
+	return db.CachedFeed, db.CachedFeedErr
+}
+
+func (db *StubDB) PutCachedFeed(_ *twt.CachedFeed) error {
+	return db.CachedFeedErr
+}
+
+func (db *StubDB) ListCachedFeeds() ([]*twt.CachedFeed, error) {
+	if db.CachedFeed == nil {
+		return nil, db.CachedFeedErr
+	}
+	return []*twt.CachedFeed{db.CachedFeed}, db.CachedFeedErr
+}
+
+func (db *StubDB) PutWebmention(_ twt.Webmention) error {
+	return db.WebmentionErr
+}
+
+func (db *StubDB) DeleteWebmention(_ string, _ string) error {
+	return db.WebmentionErr
+}
+
+func (db *StubDB) ListWebmentions() ([]twt.Webmention, error) {
+	return db.Webmentions, db.WebmentionErr
+}
+
+func (db *StubDB) PutSubscription(_ twt.Subscription) error {
+	return db.SubscriptionErr
+}
+
+func (db *StubDB) DeleteSubscription(_ string) error {
+	return db.SubscriptionErr
+}
+
+func (db *StubDB) ListSubscriptions() ([]twt.Subscription, error) {
+	return db.Subscriptions, db.SubscriptionErr
+}
+
+func (db *StubDB) GetArchive(_ string) (io.ReadCloser, error) {
+	return db.GetArchiveReadCloser, db.GetArchiveErr
+}
+
 func (db *StubDB) LogFollower(_ string) error {
 	return db.LogFollowerErr
 }
 
+func (db *StubDB) LogListFollowers(_ *twt.MultiFollower, _ []*twt.SingleFollower) error {
+	return db.LogListFollowersErr
+}
+
 type MockDB struct {
-	StatusLines []string
-	Followers   []string
+	StatusLines     []string
+	Feed            *twtxt.Feed
+	Followers       []string
+	ListedFollowers map[string][]*twt.SingleFollower
+	FollowerRecords []twt.FollowerRecord
+	Verifications   map[string]string
+	CachedFeeds     []*twt.CachedFeed
+	Webmentions     []twt.Webmention
+	Subscriptions   []twt.Subscription
 }
 
 func NewMockDB() *MockDB {
-	return &MockDB{}
+	return &MockDB{Feed: &twtxt.Feed{}, ListedFollowers: map[string][]*twt.SingleFollower{}, Verifications: map[string]string{}}
 }
 
 func (db *MockDB) Get() (io.ReadCloser, error) {
@@ -84,7 +274,92 @@ func (db *MockDB) PostStatus(reader io.Reader) error {
 	return nil
 }
 
+func (db *MockDB) Rewrite(fn func(*twtxt.Feed) error) error {
+	return fn(db.Feed)
+}
+
+func (db *MockDB) ListFollowers() ([]twt.FollowerRecord, error) {
+	return db.FollowerRecords, nil
+}
+
+func (db *MockDB) SetFollowerVerification(nick string, url string, status string, _ time.Time) error {
+	db.Verifications[nick+" "+url] = status
+	return nil
+}
+
+func (db *MockDB) GetCachedFeed(url string) (*twt.CachedFeed, error) {
+	for _, feed := range db.CachedFeeds {
+		if feed.URL == url {
+			return feed, nil
+		}
+	}
+	return nil, nil
+}
+
+func (db *MockDB) PutCachedFeed(feed *twt.CachedFeed) error {
+	for i, cached := range db.CachedFeeds {
+		if cached.URL == feed.URL {
+			db.CachedFeeds[i] = feed
+			return nil
+		}
+	}
+	db.CachedFeeds = append(db.CachedFeeds, feed)
+	return nil
+}
+
+func (db *MockDB) ListCachedFeeds() ([]*twt.CachedFeed, error) {
+	return db.CachedFeeds, nil
+}
+
+func (db *MockDB) PutWebmention(mention twt.Webmention) error {
+	db.Webmentions = append(db.Webmentions, mention)
+	return nil
+}
+
+func (db *MockDB) DeleteWebmention(source string, target string) error {
+	for i, m := range db.Webmentions {
+		if m.Source == source && m.Target == target {
+			db.Webmentions = append(db.Webmentions[:i], db.Webmentions[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (db *MockDB) ListWebmentions() ([]twt.Webmention, error) {
+	return db.Webmentions, nil
+}
+
+func (db *MockDB) PutSubscription(sub twt.Subscription) error {
+	db.Subscriptions = append(db.Subscriptions, sub)
+	return nil
+}
+
+func (db *MockDB) DeleteSubscription(callback string) error {
+	for i, sub := range db.Subscriptions {
+		if sub.Callback == callback {
+			db.Subscriptions = append(db.Subscriptions[:i], db.Subscriptions[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (db *MockDB) ListSubscriptions() ([]twt.Subscription, error) {
+	return db.Subscriptions, nil
+}
+
+func (db *MockDB) GetArchive(_ string) (io.ReadCloser, error) {
+	return nil, twt.ArchiveNotFoundErr
+}
+
 func (db *MockDB) LogFollower(follower string) error {
 	db.Followers = append(db.Followers, follower)
 	return nil
 }
+
+func (db *MockDB) LogListFollowers(list *twt.MultiFollower, followers []*twt.SingleFollower) error {
+	listURL := list.ListURL.String()
+	db.ListedFollowers[listURL] = append(db.ListedFollowers[listURL], followers...)
+	return nil
+}
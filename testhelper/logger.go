@@ -1,16 +1,30 @@
 package testhelper
 
 type MockLogger struct {
-	WritingBodyErrs     []error
-	FollowerLoggingErrs []error
-	PostingStatusErrs   []error
-	GettingTwtxtErrs    []error
+	WritingBodyErrs           []error
+	FollowerLoggingErrs       []error
+	FetchingFollowerListErrs  []error
+	VerifyingFollowerErrs     []error
+	VerifyingWebmentionErrs   []error
+	VerifyingSubscriptionErrs []error
+	PublishingFeedErrs        []error
+	SendingWebmentionErrs     []error
+	FetchingFeedErrs          []error
+	PostingStatusErrs         []error
+	GettingTwtxtErrs          []error
+	GettingFollowersErrs      []error
+	RewritingTwtxtErrs        []error
+	VerifyingAccessTokenErrs  []error
 }
 
 func (l *MockLogger) GettingTwtxtErr(err error) {
 	l.GettingTwtxtErrs = append(l.GettingTwtxtErrs, err)
 }
 
+func (l *MockLogger) GettingFollowersErr(err error) {
+	l.GettingFollowersErrs = append(l.GettingFollowersErrs, err)
+}
+
 func NewMockLogger() *MockLogger {
 	return &MockLogger{}
 }
@@ -23,16 +37,72 @@ func (l *MockLogger) FollowerLoggingErr(err error) {
 	l.FollowerLoggingErrs = append(l.FollowerLoggingErrs, err)
 }
 
+func (l *MockLogger) FetchingFollowerListErr(err error) {
+	l.FetchingFollowerListErrs = append(l.FetchingFollowerListErrs, err)
+}
+
+func (l *MockLogger) VerifyingFollowerErr(err error) {
+	l.VerifyingFollowerErrs = append(l.VerifyingFollowerErrs, err)
+}
+
+func (l *MockLogger) FetchingFeedErr(err error) {
+	l.FetchingFeedErrs = append(l.FetchingFeedErrs, err)
+}
+
+func (l *MockLogger) VerifyingWebmentionErr(err error) {
+	l.VerifyingWebmentionErrs = append(l.VerifyingWebmentionErrs, err)
+}
+
+func (l *MockLogger) SendingWebmentionErr(err error) {
+	l.SendingWebmentionErrs = append(l.SendingWebmentionErrs, err)
+}
+
+func (l *MockLogger) VerifyingSubscriptionErr(err error) {
+	l.VerifyingSubscriptionErrs = append(l.VerifyingSubscriptionErrs, err)
+}
+
+func (l *MockLogger) PublishingFeedErr(err error) {
+	l.PublishingFeedErrs = append(l.PublishingFeedErrs, err)
+}
+
 func (l *MockLogger) PostingStatusErr(err error) {
 	l.PostingStatusErrs = append(l.PostingStatusErrs, err)
 }
 
+func (l *MockLogger) VerifyingAccessTokenErr(err error) {
+	l.VerifyingAccessTokenErrs = append(l.VerifyingAccessTokenErrs, err)
+}
+
+func (l *MockLogger) RewritingTwtxtErr(err error) {
+	l.RewritingTwtxtErrs = append(l.RewritingTwtxtErrs, err)
+}
+
 type DummyLogger struct{}
 
 func (d DummyLogger) GettingTwtxtErr(_ error) {}
 
+func (d DummyLogger) GettingFollowersErr(_ error) {}
+
+func (d DummyLogger) VerifyingAccessTokenErr(_ error) {}
+
 func (d DummyLogger) WritingBodyErr(_ error) {}
 
 func (d DummyLogger) FollowerLoggingErr(_ error) {}
 
+func (d DummyLogger) FetchingFollowerListErr(_ error) {}
+
+func (d DummyLogger) VerifyingFollowerErr(_ error) {}
+
+func (d DummyLogger) FetchingFeedErr(_ error) {}
+
+func (d DummyLogger) VerifyingWebmentionErr(_ error) {}
+
+func (d DummyLogger) SendingWebmentionErr(_ error) {}
+
+func (d DummyLogger) VerifyingSubscriptionErr(_ error) {}
+
+func (d DummyLogger) PublishingFeedErr(_ error) {}
+
 func (d DummyLogger) PostingStatusErr(_ error) {}
+
+func (d DummyLogger) RewritingTwtxtErr(_ error) {}
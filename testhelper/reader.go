@@ -3,6 +3,7 @@ package testhelper
 import (
 	"bytes"
 	"io"
+	"time"
 )
 
 type StubReader struct {
@@ -15,3 +16,38 @@ func (s *StubReader) Read(_ []byte) (n int, err error) {
 }
 
 var EmptyReadCloser = io.NopCloser(bytes.NewBufferString(""))
+
+type VersionedReadCloser struct {
+	*bytes.Reader
+	ETagValue    string
+	ModTimeValue time.Time
+	Encodings    map[string][]byte
+}
+
+func NewVersionedReadCloser(content string, etag string, modTime time.Time) *VersionedReadCloser {
+	return &VersionedReadCloser{
+		Reader:       bytes.NewReader([]byte(content)),
+		ETagValue:    etag,
+		ModTimeValue: modTime,
+	}
+}
+
+func (v *VersionedReadCloser) Close() error {
+	return nil
+}
+
+func (v *VersionedReadCloser) ETag() string {
+	return v.ETagValue
+}
+
+func (v *VersionedReadCloser) ModTime() time.Time {
+	return v.ModTimeValue
+}
+
+func (v *VersionedReadCloser) Encoded(encoding string) (io.ReadSeeker, bool) {
+	encoded, ok := v.Encodings[encoding]
+	if !ok {
+		return nil, false
+	}
+	return bytes.NewReader(encoded), true
+}
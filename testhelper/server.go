@@ -0,0 +1,15 @@
+package testhelper
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// NewServer starts a server standing in for a remote site and returns its URL.
+// The server is closed when t finishes.
+func NewServer(t testing.TB, handler http.Handler) string {
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
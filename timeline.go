@@ -0,0 +1,183 @@
+package twt
+
+import (
+	"context"
+	"github.com/m25n/twt/task"
+	"github.com/m25n/twt/twtxt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CachedFeed is a remote feed as it was last fetched.
+type CachedFeed struct {
+	URL          string    `json:"url"`
+	Nick         string    `json:"nick,omitempty"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	FetchedAt    time.Time `json:"fetched_at"`
+	Content      string    `json:"content,omitempty"`
+}
+
+func (c *CachedFeed) Parse() (*twtxt.Feed, error) {
+	return twtxt.ParseLenient(strings.NewReader(c.Content))
+}
+
+// FeedFetcher keeps the cached copies of remote feeds up to date.
+type FeedFetcher struct {
+	logger      Logger
+	db          DB
+	enqueueTask task.EnqueueFunc
+	client      *http.Client
+	userAgent   string
+	now         func() time.Time
+}
+
+func NewFeedFetcher(logger Logger, db DB, enqueueTask task.EnqueueFunc, client *http.Client, userAgent string) *FeedFetcher {
+	return &FeedFetcher{logger: logger, db: db, enqueueTask: enqueueTask, client: client, userAgent: userAgent, now: time.Now}
+}
+
+// FetchFollowing enqueues a task per feed we follow that fetches it.
+func (f *FeedFetcher) FetchFollowing(ctx context.Context) {
+	feed, err := getFeed(f.db)
+	if err != nil {
+		f.logger.GettingTwtxtErr(err)
+		return
+	}
+	for _, following := range parseFollowing(feed) {
+		if err := f.enqueueFetch(ctx, following.Nick, following.URL); err != nil {
+			f.logger.FetchingFeedErr(err)
+			return
+		}
+	}
+}
+
+func (f *FeedFetcher) enqueueFetch(ctx context.Context, nick string, url string) error {
+	return f.enqueueTask(ctx, func(ctx context.Context) {
+		if err := f.Fetch(ctx, nick, url); err != nil {
+			f.logger.FetchingFeedErr(err)
+		}
+	})
+}
+
+// Fetch fetches the feed at url, conditionally when it is cached, and caches
+// it.
+func (f *FeedFetcher) Fetch(ctx context.Context, nick string, url string) error {
+	cached, err := f.db.GetCachedFeed(url)
+	if err != nil {
+		return err
+	}
+	if cached == nil {
+		cached = &CachedFeed{URL: url}
+	}
+	header := http.Header{}
+	if cached.ETag != "" {
+		header.Set("If-None-Match", cached.ETag)
+	}
+	if cached.LastModified != "" {
+		header.Set("If-Modified-Since", cached.LastModified)
+	}
+	res, body, err := fetch(ctx, f.client, f.userAgent, url, header)
+	if err != nil {
+		return err
+	}
+	if nick != "" {
+		cached.Nick = nick
+	}
+	cached.FetchedAt = f.now()
+	if res.StatusCode == http.StatusOK {
+		cached.Content = string(body)
+		cached.ETag = res.Header.Get("ETag")
+		cached.LastModified = res.Header.Get("Last-Modified")
+	}
+	return f.db.PutCachedFeed(cached)
+}
+
+// TimelineTwt is a twt of a feed on the timeline.
+type TimelineTwt struct {
+	Nick    string    `json:"nick"`
+	URL     string    `json:"url"`
+	Hash    string    `json:"hash"`
+	Created time.Time `json:"created"`
+	Text    string    `json:"text"`
+}
+
+func timelineTwts(nick string, fallbackURL string, feed *twtxt.Feed) []TimelineTwt {
+	u := feedURL(feed, fallbackURL)
+	if nicks := feed.Metadata("nick"); len(nicks) > 0 && nick == "" {
+		nick = nicks[0]
+	}
+	twts := make([]TimelineTwt, 0, len(feed.Twts))
+	for _, t := range feed.Twts {
+		twts = append(twts, TimelineTwt{Nick: nick, URL: u, Hash: t.Hash(u), Created: t.Created, Text: t.Text})
+	}
+	return twts
+}
+
+func getTimelineHandler(logger Logger, db DB, fallbackURL string, now func() time.Time) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		limit, ok := parseLimit(req.URL.Query().Get("limit"), 50)
+		if !ok {
+			http.Error(res, "invalid limit parameter", http.StatusBadRequest)
+			return
+		}
+		since, ok := parseSince(req.URL.Query().Get("since"), now())
+		if !ok {
+			http.Error(res, "invalid since parameter", http.StatusBadRequest)
+			return
+		}
+		feed, err := getFeed(db)
+		if err != nil {
+			logger.GettingTwtxtErr(err)
+			res.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		timeline := timelineTwts("", fallbackURL, feed)
+		for _, following := range parseFollowing(feed) {
+			cached, err := db.GetCachedFeed(following.URL)
+			if err != nil {
+				logger.GettingTwtxtErr(err)
+				res.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			if cached == nil {
+				continue
+			}
+			followed, err := cached.Parse()
+			if err != nil {
+				continue
+			}
+			timeline = append(timeline, timelineTwts(following.Nick, following.URL, followed)...)
+		}
+		writeJSON(logger, res, http.StatusOK, newestTwts(timeline, since, limit))
+	}
+}
+
+func newestTwts(twts []TimelineTwt, since time.Time, limit int) []TimelineTwt {
+	sort.SliceStable(twts, func(i, j int) bool {
+		return twts[i].Created.After(twts[j].Created)
+	})
+	newest := make([]TimelineTwt, 0, limit)
+	for _, t := range twts {
+		if len(newest) == limit || t.Created.Before(since) {
+			break
+		}
+		newest = append(newest, t)
+	}
+	return newest
+}
+
+const maxLimit = 1000
+
+func parseLimit(limit string, fallback int) (int, bool) {
+	if limit == "" {
+		return fallback, true
+	}
+	n, err := strconv.Atoi(limit)
+	if err != nil || n < 1 || n > maxLimit {
+		return 0, false
+	}
+	return n, true
+}
@@ -0,0 +1,79 @@
+package twt_test
+
+import (
+	"context"
+	"github.com/m25n/twt"
+	"github.com/m25n/twt/task"
+	"github.com/m25n/twt/testhelper"
+	"github.com/m25n/twt/twtxt"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestFeedFetcher(t *testing.T) {
+	following := func(url string) *testhelper.FakeDB {
+		db := testhelper.NewFakeDB()
+		_ = db.Rewrite(func(feed *twtxt.Feed) error {
+			feed.SetMetadata("follow", "alice "+url)
+			return nil
+		})
+		return db
+	}
+
+	t.Run("fetches followed feeds conditionally", func(t *testing.T) {
+		var conditional []string
+		remote := testhelper.NewServer(t, http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			conditional = append(conditional, req.Header.Get("If-None-Match"))
+			if req.Header.Get("If-None-Match") == `"v1"` {
+				res.WriteHeader(http.StatusNotModified)
+				return
+			}
+			res.Header().Set("ETag", `"v1"`)
+			_, _ = res.Write([]byte(status))
+		}))
+		db := following(remote + "/twtxt.txt")
+		fetcher := twt.NewFeedFetcher(testhelper.DummyLogger{}, db, testhelper.SyncEnqueueTask, twt.NewHTTPClient(time.Second), "twtd/test")
+
+		fetcher.FetchFollowing(context.Background())
+		fetcher.FetchFollowing(context.Background())
+
+		require.Equal(t, []string{"", `"v1"`}, conditional)
+		cached, _ := db.GetCachedFeed(remote + "/twtxt.txt")
+		require.Equal(t, "alice", cached.Nick)
+		require.Equal(t, status, cached.Content)
+		require.Equal(t, `"v1"`, cached.ETag)
+	})
+
+	t.Run("fetches each followed feed in its own task", func(t *testing.T) {
+		db := testhelper.NewFakeDB()
+		_ = db.Rewrite(func(feed *twtxt.Feed) error {
+			feed.SetMetadata("follow", "alice https://a.example.com/twtxt.txt", "bob https://b.example.com/twtxt.txt")
+			return nil
+		})
+		var enqueued int
+		enqueue := func(_ context.Context, _ task.Task) error {
+			enqueued++
+			return nil
+		}
+		fetcher := twt.NewFeedFetcher(testhelper.DummyLogger{}, db, enqueue, twt.NewHTTPClient(time.Second), "twtd/test")
+
+		fetcher.FetchFollowing(context.Background())
+
+		require.Equal(t, 2, enqueued)
+	})
+
+	t.Run("logs errors of unreachable feeds", func(t *testing.T) {
+		remote := testhelper.NewServer(t, http.NotFoundHandler())
+		logger := testhelper.NewMockLogger()
+		db := following(remote + "/twtxt.txt")
+		fetcher := twt.NewFeedFetcher(logger, db, testhelper.SyncEnqueueTask, twt.NewHTTPClient(time.Second), "twtd/test")
+
+		fetcher.FetchFollowing(context.Background())
+
+		require.Len(t, logger.FetchingFeedErrs, 1)
+		feeds, _ := db.ListCachedFeeds()
+		require.Empty(t, feeds)
+	})
+}
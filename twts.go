@@ -0,0 +1,185 @@
+package twt
+
+import (
+	"bytes"
+	"errors"
+	"github.com/m25n/twt/twtxt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	TwtNotFoundErr  = errors.New("twt not found")
+	AmbiguousTwtErr = errors.New("more than one twt matches")
+)
+
+type twtMatcher func(feedURL string, t twtxt.Twt) bool
+
+// parseTwtID matches twts by their hash or their RFC 3339 timestamp.
+func parseTwtID(id string) (twtMatcher, bool) {
+	if twtxt.IsHash(id) {
+		return func(feedURL string, t twtxt.Twt) bool {
+			return t.Hash(feedURL) == id
+		}, true
+	}
+	created, err := time.Parse(time.RFC3339, id)
+	if err != nil {
+		return nil, false
+	}
+	return func(_ string, t twtxt.Twt) bool {
+		return t.Created.Equal(created)
+	}, true
+}
+
+// feedURL returns the "# url =" metadata of feed, or fallback.
+func feedURL(feed *twtxt.Feed, fallback string) string {
+	if u := feed.URL(); u != "" {
+		return u
+	}
+	return fallback
+}
+
+func findTwt(feed *twtxt.Feed, fallbackURL string, match twtMatcher) (int, error) {
+	u := feedURL(feed, fallbackURL)
+	found := -1
+	for i, t := range feed.Twts {
+		if !match(u, t) {
+			continue
+		}
+		if found != -1 {
+			return -1, AmbiguousTwtErr
+		}
+		found = i
+	}
+	if found == -1 {
+		return -1, TwtNotFoundErr
+	}
+	return found, nil
+}
+
+func listTwtsHandler(logger Logger, db DB, fallbackURL string) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		feed, err := getFeed(db)
+		if err != nil {
+			logger.GettingTwtxtErr(err)
+			res.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		u := feedURL(feed, fallbackURL)
+		res.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		buf := bytes.NewBuffer(nil)
+		for _, t := range feed.Twts {
+			buf.WriteString(t.Hash(u) + "\t" + t.String() + "\n")
+		}
+		if _, err := io.Copy(res, buf); err != nil {
+			logger.WritingBodyErr(err)
+		}
+	}
+}
+
+func getTwtHandler(logger Logger, db DB, fallbackURL string) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		match, ok := parseTwtID(twtID(req))
+		if !ok {
+			http.NotFound(res, req)
+			return
+		}
+		feed, err := getFeed(db)
+		if err != nil {
+			logger.GettingTwtxtErr(err)
+			res.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		i, err := findTwt(feed, fallbackURL, match)
+		switch {
+		case errors.Is(err, TwtNotFoundErr):
+			http.NotFound(res, req)
+			return
+		case errors.Is(err, AmbiguousTwtErr):
+			http.Error(res, err.Error(), http.StatusConflict)
+			return
+		}
+		res.Header().Set("Content-Type", "text/vnd.twtxt+plain")
+		if _, err := io.WriteString(res, feed.Twts[i].String()+"\n"); err != nil {
+			logger.WritingBodyErr(err)
+		}
+	}
+}
+
+func deleteTwtHandler(logger Logger, db DB, fallbackURL string) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		match, ok := parseTwtID(twtID(req))
+		if !ok {
+			http.NotFound(res, req)
+			return
+		}
+		err := db.Rewrite(func(feed *twtxt.Feed) error {
+			i, err := findTwt(feed, fallbackURL, match)
+			if err != nil {
+				return err
+			}
+			feed.Twts = append(feed.Twts[:i], feed.Twts[i+1:]...)
+			return nil
+		})
+		writeTwtRewriteResult(logger, res, req, err)
+	}
+}
+
+func putTwtHandler(logger Logger, db DB, fallbackURL string) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		match, ok := parseTwtID(twtID(req))
+		if !ok {
+			http.NotFound(res, req)
+			return
+		}
+		mediaType, _, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+		if err != nil {
+			res.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if mediaType != "text/plain" {
+			res.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(res, req.Body, maxStatusSize))
+		if err != nil {
+			http.Error(res, "error reading body", http.StatusBadRequest)
+			return
+		}
+		text, err := statusText(body)
+		if err != nil {
+			http.Error(res, err.Error(), http.StatusBadRequest)
+			return
+		}
+		err = db.Rewrite(func(feed *twtxt.Feed) error {
+			i, err := findTwt(feed, fallbackURL, match)
+			if err != nil {
+				return err
+			}
+			feed.Twts[i] = feed.Twts[i].WithText(string(text))
+			return nil
+		})
+		writeTwtRewriteResult(logger, res, req, err)
+	}
+}
+
+func twtID(req *http.Request) string {
+	return strings.TrimPrefix(req.URL.Path, "/twts/")
+}
+
+func writeTwtRewriteResult(logger Logger, res http.ResponseWriter, req *http.Request, err error) {
+	switch {
+	case err == nil:
+		res.WriteHeader(http.StatusNoContent)
+	case errors.Is(err, TwtNotFoundErr):
+		http.NotFound(res, req)
+	case errors.Is(err, AmbiguousTwtErr):
+		http.Error(res, err.Error(), http.StatusConflict)
+	default:
+		logger.RewritingTwtxtErr(err)
+		res.WriteHeader(http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,251 @@
+package twtxt
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+type Feed struct {
+	Comments []Comment
+	Twts     []Twt
+
+	// layout remembers the lines of a parsed feed, so WriteTo keeps comments
+	// where they were, blank lines, lines that are not twts and the bytes of
+	// twts nobody changed.
+	layout *layout
+}
+
+type lineKind int
+
+const (
+	otherLine lineKind = iota
+	commentLine
+	twtLine
+)
+
+type layout struct {
+	lines []layoutLine
+}
+
+type layoutLine struct {
+	kind lineKind
+	text string
+}
+
+type Comment string
+
+var metadataRegex = regexp.MustCompile(`^#\s*([A-Za-z0-9_.-]+)\s*=\s*(.*?)\s*$`)
+
+func (c Comment) Metadata() (key string, value string, ok bool) {
+	matches := metadataRegex.FindStringSubmatch(string(c))
+	if len(matches) != 3 {
+		return "", "", false
+	}
+	return matches[1], matches[2], true
+}
+
+func MetadataComment(key, value string) Comment {
+	return Comment(fmt.Sprintf("# %s = %s", key, value))
+}
+
+type ParseErr struct {
+	Line int
+	Err  error
+}
+
+func (e *ParseErr) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Err.Error())
+}
+
+func (e *ParseErr) Unwrap() error {
+	return e.Err
+}
+
+// Parse reads a whole twtxt.txt, failing on the first line that is neither a
+// comment nor a valid twt.
+func Parse(r io.Reader) (*Feed, error) {
+	return parse(r, true)
+}
+
+// ParseLenient reads a twtxt.txt that may contain lines that are not valid
+// twts. They are skipped, but WriteTo writes them back unchanged.
+func ParseLenient(r io.Reader) (*Feed, error) {
+	return parse(r, false)
+}
+
+func parse(r io.Reader, strict bool) (*Feed, error) {
+	feed := &Feed{layout: &layout{}}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		kind := otherLine
+		switch {
+		case strings.TrimSpace(line) == "":
+		case strings.HasPrefix(line, "#"):
+			kind = commentLine
+			feed.Comments = append(feed.Comments, Comment(line))
+		default:
+			t, err := ParseTwt(line)
+			if err != nil && strict {
+				return nil, &ParseErr{Line: n, Err: err}
+			}
+			if err == nil {
+				kind = twtLine
+				t.origin, t.line = feed.layout, len(feed.layout.lines)
+				feed.Twts = append(feed.Twts, t)
+			}
+		}
+		feed.layout.lines = append(feed.layout.lines, layoutLine{kind: kind, text: line})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return feed, nil
+}
+
+func (f *Feed) Metadata(key string) []string {
+	var values []string
+	for _, c := range f.Comments {
+		if k, v, ok := c.Metadata(); ok && k == key {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// URL returns the feed URL advertised in the metadata, if any.
+func (f *Feed) URL() string {
+	if urls := f.Metadata("url"); len(urls) > 0 {
+		return urls[0]
+	}
+	return ""
+}
+
+// SetMetadata replaces every value of key with values. The first existing
+// entry is replaced in place so the header keeps its order; new keys are
+// appended after the last metadata comment.
+func (f *Feed) SetMetadata(key string, values ...string) {
+	comments := make([]Comment, 0, len(f.Comments)+len(values))
+	inserted := false
+	insertAt := -1
+	for _, c := range f.Comments {
+		k, _, ok := c.Metadata()
+		if ok && k == key {
+			if !inserted {
+				for _, v := range values {
+					comments = append(comments, MetadataComment(key, v))
+				}
+				inserted = true
+			}
+			continue
+		}
+		comments = append(comments, c)
+		if ok {
+			insertAt = len(comments)
+		}
+	}
+	if !inserted && len(values) > 0 {
+		added := make([]Comment, 0, len(values))
+		for _, v := range values {
+			added = append(added, MetadataComment(key, v))
+		}
+		if insertAt == -1 {
+			insertAt = len(comments)
+		}
+		comments = append(comments[:insertAt], append(added, comments[insertAt:]...)...)
+	}
+	f.Comments = comments
+}
+
+// WriteTo writes the feed as twtxt.txt. A parsed feed is written in its
+// original layout: comments and twts stay on their lines, changed ones are
+// written in place and removed ones are dropped. New comments follow the
+// comment they were added after and new twts are appended.
+func (f *Feed) WriteTo(w io.Writer) (int64, error) {
+	bw := bufio.NewWriter(w)
+	var written int64
+	var err error
+	write := func(line string) {
+		if err != nil {
+			return
+		}
+		var n int
+		n, err = bw.WriteString(line + "\n")
+		written += int64(n)
+	}
+	var lines []layoutLine
+	if f.layout != nil {
+		lines = f.layout.lines
+	}
+
+	// Comments are matched to the original ones by text.
+	remaining := map[Comment]int{}
+	lastComment := -1
+	for i, l := range lines {
+		if l.kind == commentLine {
+			remaining[Comment(l.text)]++
+			lastComment = i
+		}
+	}
+	next := 0
+	writeComments := func(until int) {
+		for ; next < until; next++ {
+			write(string(f.Comments[next]))
+		}
+	}
+	writeNewComments := func() {
+		for next < len(f.Comments) && remaining[f.Comments[next]] == 0 {
+			write(string(f.Comments[next]))
+			next++
+		}
+	}
+	if lastComment == -1 {
+		writeComments(len(f.Comments))
+	}
+
+	// Twts are matched by the line they were parsed from.
+	twtAt := map[int]int{}
+	var added []int
+	for i, t := range f.Twts {
+		if _, taken := twtAt[t.line]; t.origin == f.layout && f.layout != nil && !taken {
+			twtAt[t.line] = i
+		} else {
+			added = append(added, i)
+		}
+	}
+
+	for i, l := range lines {
+		switch l.kind {
+		case otherLine:
+			write(l.text)
+		case commentLine:
+			c := Comment(l.text)
+			remaining[c]--
+			for j := next; j < len(f.Comments); j++ {
+				if f.Comments[j] == c {
+					writeComments(j + 1)
+					break
+				}
+			}
+			writeNewComments()
+			if i == lastComment {
+				writeComments(len(f.Comments))
+			}
+		case twtLine:
+			if t, ok := twtAt[i]; ok {
+				write(f.Twts[t].String())
+			}
+		}
+	}
+	for _, t := range added {
+		write(f.Twts[t].String())
+	}
+	if err != nil {
+		return written, err
+	}
+	return written, bw.Flush()
+}
@@ -0,0 +1,29 @@
+package twtxt
+
+import (
+	"encoding/base32"
+	"golang.org/x/crypto/blake2b"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const HashLength = 7
+
+var hashEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+var hashRegex = regexp.MustCompile(`^[a-z2-7]{7}$`)
+
+// Hash identifies a twt the way Yarn does: the last characters of the
+// lowercase base32 encoded blake2b-256 digest of the feed URL, the timestamp
+// truncated to seconds and the text.
+func (t Twt) Hash(feedURL string) string {
+	payload := feedURL + "\n" + t.Created.Truncate(time.Second).Format(time.RFC3339) + "\n" + t.Text
+	sum := blake2b.Sum256([]byte(payload))
+	hash := strings.ToLower(hashEncoding.EncodeToString(sum[:]))
+	return hash[len(hash)-HashLength:]
+}
+
+func IsHash(s string) bool {
+	return hashRegex.MatchString(s)
+}
@@ -0,0 +1,141 @@
+package twtxt
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+type Twt struct {
+	Created  time.Time
+	Text     string
+	Mentions []Mention
+	Hashtags []string
+	Links    []string
+	Subject  string
+
+	// timestamp is the timestamp as written in the feed the twt was parsed
+	// from, kept so unchanged twts are written back byte for byte.
+	timestamp string
+	stamped   time.Time
+	// origin and line locate a parsed twt in the layout of its feed.
+	origin *layout
+	line   int
+}
+
+type Mention struct {
+	Nick string
+	URL  string
+}
+
+func (m Mention) String() string {
+	if m.Nick == "" {
+		return fmt.Sprintf("@<%s>", m.URL)
+	}
+	return fmt.Sprintf("@<%s %s>", m.Nick, m.URL)
+}
+
+var (
+	MissingTabErr  = errors.New("missing tab between timestamp and text")
+	MissingTextErr = errors.New("missing text")
+)
+
+type InvalidTimestampErr struct {
+	Timestamp string
+}
+
+func (e *InvalidTimestampErr) Error() string {
+	return fmt.Sprintf("invalid RFC 3339 timestamp %q", e.Timestamp)
+}
+
+func NewTwt(created time.Time, text string) Twt {
+	t := Twt{Created: created, Text: text}
+	t.Mentions = parseMentions(text)
+	t.Hashtags = parseHashtags(text)
+	t.Links = parseLinks(text)
+	t.Subject = parseSubject(text)
+	return t
+}
+
+func ParseTwt(line string) (Twt, error) {
+	line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+	timestamp, text, found := strings.Cut(line, "\t")
+	if !found {
+		return Twt{}, MissingTabErr
+	}
+	created, err := time.Parse(time.RFC3339, timestamp)
+	if err != nil {
+		return Twt{}, &InvalidTimestampErr{Timestamp: timestamp}
+	}
+	if len(strings.TrimSpace(text)) == 0 {
+		return Twt{}, MissingTextErr
+	}
+	t := NewTwt(created, text)
+	t.timestamp, t.stamped = timestamp, created
+	return t, nil
+}
+
+// WithText returns a copy of t with text, keeping its timestamp and its
+// place in the feed.
+func (t Twt) WithText(text string) Twt {
+	edited := NewTwt(t.Created, text)
+	edited.timestamp, edited.stamped = t.timestamp, t.stamped
+	edited.origin, edited.line = t.origin, t.line
+	return edited
+}
+
+// String formats t as a line of twtxt.txt. The timestamp is written as it
+// was parsed unless Created changed since.
+func (t Twt) String() string {
+	timestamp := t.Created.Format(time.RFC3339Nano)
+	if t.timestamp != "" && t.stamped.Equal(t.Created) {
+		timestamp = t.timestamp
+	}
+	return timestamp + "\t" + t.Text
+}
+
+var mentionRegex = regexp.MustCompile(`@<(?:([^\s>]+)\s+)?([^\s>]+)>`)
+var hashtagRegex = regexp.MustCompile(`#<([^\s>]+)(?:\s+[^\s>]+)?>|(?:^|\s)#([\p{L}\p{N}_-]+)`)
+var subjectRegex = regexp.MustCompile(`\(#<?([a-z2-7]+)(?:\s+[^\s>)]+)?>?\)`)
+var linkRegex = regexp.MustCompile(`https?://[^\s<>"()\[\]]+`)
+
+func parseMentions(text string) []Mention {
+	var mentions []Mention
+	for _, match := range mentionRegex.FindAllStringSubmatch(text, -1) {
+		mentions = append(mentions, Mention{Nick: match[1], URL: match[2]})
+	}
+	return mentions
+}
+
+func parseHashtags(text string) []string {
+	var hashtags []string
+	for _, match := range hashtagRegex.FindAllStringSubmatch(text, -1) {
+		if match[1] != "" {
+			hashtags = append(hashtags, match[1])
+		} else {
+			hashtags = append(hashtags, match[2])
+		}
+	}
+	return hashtags
+}
+
+// parseSubject returns the hash of the twt this one replies to, if any.
+func parseSubject(text string) string {
+	matches := subjectRegex.FindStringSubmatch(text)
+	if len(matches) != 2 {
+		return ""
+	}
+	return matches[1]
+}
+
+func parseLinks(text string) []string {
+	text = mentionRegex.ReplaceAllString(text, "")
+	text = hashtagRegex.ReplaceAllString(text, " ")
+	var links []string
+	for _, link := range linkRegex.FindAllString(text, -1) {
+		links = append(links, strings.TrimRight(link, ".,;:!?'"))
+	}
+	return links
+}
@@ -0,0 +1,195 @@
+package twtxt_test
+
+import (
+	"bytes"
+	"errors"
+	"github.com/m25n/twt/twtxt"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"time"
+)
+
+const feed = `# nick = somebody
+# url = https://example.com/twtxt.txt
+# follow = friend https://friend.example.com/twtxt.txt
+2022-01-01T00:00:00Z	I have a thought
+2022-01-02T12:30:00+01:00	@<friend https://friend.example.com/twtxt.txt> look at https://example.com/page. #<go https://example.com/search?tag=go> #twtxt
+`
+
+func TestParse(t *testing.T) {
+	t.Run("parses comments and twts", func(t *testing.T) {
+		f, err := twtxt.Parse(strings.NewReader(feed))
+
+		require.NoError(t, err)
+		require.Len(t, f.Comments, 3)
+		require.Len(t, f.Twts, 2)
+		require.Equal(t, "I have a thought", f.Twts[0].Text)
+		require.True(t, f.Twts[0].Created.Equal(time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)))
+	})
+
+	t.Run("keeps the timestamp zone", func(t *testing.T) {
+		f, _ := twtxt.Parse(strings.NewReader(feed))
+
+		_, offset := f.Twts[1].Created.Zone()
+		require.Equal(t, 3600, offset)
+	})
+
+	t.Run("extracts mentions, hashtags and links", func(t *testing.T) {
+		f, _ := twtxt.Parse(strings.NewReader(feed))
+
+		require.Equal(t, []twtxt.Mention{{Nick: "friend", URL: "https://friend.example.com/twtxt.txt"}}, f.Twts[1].Mentions)
+		require.Equal(t, []string{"go", "twtxt"}, f.Twts[1].Hashtags)
+		require.Equal(t, []string{"https://example.com/page"}, f.Twts[1].Links)
+	})
+
+	t.Run("reports the line of an invalid twt", func(t *testing.T) {
+		_, err := twtxt.Parse(strings.NewReader("# nick = somebody\n\nnot a twt\n"))
+
+		var parseErr *twtxt.ParseErr
+		require.True(t, errors.As(err, &parseErr))
+		require.Equal(t, 3, parseErr.Line)
+		require.ErrorIs(t, err, twtxt.MissingTabErr)
+	})
+
+	t.Run("skips invalid twts when lenient", func(t *testing.T) {
+		f, err := twtxt.ParseLenient(strings.NewReader("# nick = somebody\nnot a twt\n2022-01-01T00:00:00Z\tI have a thought\n"))
+
+		require.NoError(t, err)
+		require.Len(t, f.Comments, 1)
+		require.Len(t, f.Twts, 1)
+	})
+
+	t.Run("round trips through WriteTo", func(t *testing.T) {
+		f, _ := twtxt.Parse(strings.NewReader(feed))
+		buf := bytes.NewBuffer(nil)
+
+		_, err := f.WriteTo(buf)
+
+		require.NoError(t, err)
+		require.Equal(t, feed, buf.String())
+	})
+
+	layout := "# nick = alice\n" +
+		"\n" +
+		"2022-01-01T00:00:00.000+00:00\tfirst\n" +
+		"# --- 2022-02 ---\n" +
+		"2022-02-01T00:00:00Z\tsecond\n" +
+		"not a twt\n" +
+		"2022-03-01T00:00:00Z\tthird\n"
+
+	t.Run("keeps comments, blank lines and timestamps when a twt is removed", func(t *testing.T) {
+		f, _ := twtxt.ParseLenient(strings.NewReader(layout))
+		f.Twts = append(f.Twts[:1], f.Twts[2:]...)
+		buf := bytes.NewBuffer(nil)
+
+		_, err := f.WriteTo(buf)
+
+		require.NoError(t, err)
+		require.Equal(t, "# nick = alice\n"+
+			"\n"+
+			"2022-01-01T00:00:00.000+00:00\tfirst\n"+
+			"# --- 2022-02 ---\n"+
+			"not a twt\n"+
+			"2022-03-01T00:00:00Z\tthird\n", buf.String())
+	})
+
+	t.Run("writes edited twts in place", func(t *testing.T) {
+		f, _ := twtxt.ParseLenient(strings.NewReader(layout))
+		f.Twts[0] = f.Twts[0].WithText("first, edited")
+		f.Twts = append(f.Twts, twtxt.NewTwt(time.Date(2022, 4, 1, 0, 0, 0, 0, time.UTC), "fourth"))
+		f.SetMetadata("description", "hi")
+		buf := bytes.NewBuffer(nil)
+
+		_, err := f.WriteTo(buf)
+
+		require.NoError(t, err)
+		require.Equal(t, "# nick = alice\n"+
+			"# description = hi\n"+
+			"\n"+
+			"2022-01-01T00:00:00.000+00:00\tfirst, edited\n"+
+			"# --- 2022-02 ---\n"+
+			"2022-02-01T00:00:00Z\tsecond\n"+
+			"not a twt\n"+
+			"2022-03-01T00:00:00Z\tthird\n"+
+			"2022-04-01T00:00:00Z\tfourth\n", buf.String())
+	})
+}
+
+func TestParseTwt(t *testing.T) {
+	for name, tc := range map[string]struct {
+		line string
+		err  string
+	}{
+		"missing tab":       {"2022-01-01T00:00:00Z I have a thought", "missing tab between timestamp and text"},
+		"invalid timestamp": {"2022-01-01\tI have a thought", `invalid RFC 3339 timestamp "2022-01-01"`},
+		"missing text":      {"2022-01-01T00:00:00Z\t  ", "missing text"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := twtxt.ParseTwt(tc.line)
+
+			require.EqualError(t, err, tc.err)
+		})
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	t.Run("reads every value of a key", func(t *testing.T) {
+		f, _ := twtxt.Parse(strings.NewReader(feed + "# follow = other https://other.example.com/twtxt.txt\n"))
+
+		require.Equal(t, []string{
+			"friend https://friend.example.com/twtxt.txt",
+			"other https://other.example.com/twtxt.txt",
+		}, f.Metadata("follow"))
+	})
+
+	t.Run("replaces existing values in place", func(t *testing.T) {
+		f, _ := twtxt.Parse(strings.NewReader(feed))
+
+		f.SetMetadata("nick", "someone")
+
+		require.Equal(t, twtxt.Comment("# nick = someone"), f.Comments[0])
+	})
+
+	t.Run("appends new keys after the existing metadata", func(t *testing.T) {
+		f := &twtxt.Feed{Comments: []twtxt.Comment{"# nick = somebody", "# just a comment"}}
+
+		f.SetMetadata("description", "hello")
+
+		require.Equal(t, []twtxt.Comment{"# nick = somebody", "# description = hello", "# just a comment"}, f.Comments)
+	})
+
+	t.Run("removes a key without values", func(t *testing.T) {
+		f, _ := twtxt.Parse(strings.NewReader(feed))
+
+		f.SetMetadata("follow")
+
+		require.Empty(t, f.Metadata("follow"))
+	})
+}
+
+func TestHash(t *testing.T) {
+	t.Run("hashes the feed url, timestamp and text", func(t *testing.T) {
+		twt, _ := twtxt.ParseTwt("2020-12-13T08:45:23+01:00\tHello World!")
+
+		require.Equal(t, "7evpj2q", twt.Hash("https://example.com/twtxt.txt"))
+	})
+
+	t.Run("ignores fractional seconds", func(t *testing.T) {
+		twt, _ := twtxt.ParseTwt("2020-12-13T08:45:23.999+01:00\tHello World!")
+
+		require.Equal(t, "7evpj2q", twt.Hash("https://example.com/twtxt.txt"))
+	})
+
+	t.Run("depends on the feed url", func(t *testing.T) {
+		twt, _ := twtxt.ParseTwt("2020-12-13T08:45:23+01:00\tHello World!")
+
+		require.NotEqual(t, twt.Hash("https://example.com/twtxt.txt"), twt.Hash("https://example.org/twtxt.txt"))
+	})
+
+	t.Run("parses reply subjects", func(t *testing.T) {
+		twt, _ := twtxt.ParseTwt("2020-12-13T08:45:23+01:00\t(#7evpj2q) @<somebody https://example.com/twtxt.txt> Hello back!")
+
+		require.Equal(t, "7evpj2q", twt.Subject)
+	})
+}
@@ -0,0 +1,96 @@
+package twt
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/m25n/twt/task"
+	"github.com/m25n/twt/twtxt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	Verified   = "verified"
+	Unverified = "unverified"
+)
+
+var FollowerNotFoundErr = errors.New("follower not found")
+
+// FollowerVerifier checks that followers really follow us by fetching the
+// feed they claim to be.
+type FollowerVerifier struct {
+	logger      Logger
+	db          DB
+	enqueueTask task.EnqueueFunc
+	client      *http.Client
+	userAgent   string
+	feedURL     string
+	now         func() time.Time
+}
+
+func NewFollowerVerifier(logger Logger, db DB, enqueueTask task.EnqueueFunc, client *http.Client, userAgent string, feedURL string) *FollowerVerifier {
+	return &FollowerVerifier{logger: logger, db: db, enqueueTask: enqueueTask, client: client, userAgent: userAgent, feedURL: feedURL, now: time.Now}
+}
+
+// VerifyAll enqueues a task per SingleFollower in the registry that verifies
+// it.
+func (v *FollowerVerifier) VerifyAll(ctx context.Context) {
+	records, err := v.db.ListFollowers()
+	if err != nil {
+		v.logger.GettingFollowersErr(err)
+		return
+	}
+	for _, r := range records {
+		follower, ok := r.Follower().(*SingleFollower)
+		if !ok {
+			continue
+		}
+		r := r
+		err := v.enqueueTask(ctx, func(ctx context.Context) {
+			verified, err := v.Verify(ctx, follower)
+			if err != nil {
+				v.logger.VerifyingFollowerErr(err)
+				return
+			}
+			status := Unverified
+			if verified {
+				status = Verified
+			}
+			if err := v.db.SetFollowerVerification(r.Nick, r.URL, status, v.now()); err != nil {
+				v.logger.VerifyingFollowerErr(err)
+			}
+		})
+		if err != nil {
+			v.logger.VerifyingFollowerErr(err)
+			return
+		}
+	}
+}
+
+// Verify reports whether the feed follower claims to be follows ours or, when
+// it lists no follows, announces the same nick.
+func (v *FollowerVerifier) Verify(ctx context.Context, follower *SingleFollower) (bool, error) {
+	_, body, err := fetch(ctx, v.client, v.userAgent, follower.URL.String(), nil)
+	if err != nil {
+		return false, err
+	}
+	feed, err := twtxt.ParseLenient(bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	follows := feed.Metadata("follow")
+	if len(follows) == 0 {
+		nicks := feed.Metadata("nick")
+		return len(nicks) > 0 && nicks[0] == follower.Nick, nil
+	}
+	for _, follow := range follows {
+		for _, field := range strings.Fields(follow) {
+			if field == v.feedURL {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,93 @@
+package twt_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/m25n/twt"
+	"github.com/m25n/twt/task"
+	"github.com/m25n/twt/testhelper"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestFollowerVerifier(t *testing.T) {
+	const feedURL = "https://example.com/twtxt.txt"
+	newFollower := func(t *testing.T, nick string, twtxt string) *twt.SingleFollower {
+		remote := testhelper.NewServer(t, http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			res.Header().Set("Content-Type", "text/plain")
+			_, _ = fmt.Fprint(res, twtxt)
+		}))
+		u, _ := url.Parse(remote + "/twtxt.txt")
+		return &twt.SingleFollower{Nick: nick, URL: u}
+	}
+
+	for name, tc := range map[string]struct {
+		nick     string
+		twtxt    string
+		verified bool
+	}{
+		"follows us":             {"alice", "# nick = someone\n# follow = somebody " + feedURL + "\n", true},
+		"follows us by bare url": {"alice", "# follow = " + feedURL + "\n", true},
+		"follows others":         {"alice", "# nick = alice\n# follow = other https://other.example.com/twtxt.txt\n", false},
+		"matching nick":          {"alice", "# nick = alice\nnot a twt\n2022-01-01T00:00:00Z\tHello\n", true},
+		"different nick":         {"alice", "# nick = mallory\n", false},
+		"no metadata":            {"alice", "2022-01-01T00:00:00Z\tHello\n", false},
+	} {
+		t.Run(name, func(t *testing.T) {
+			follower := newFollower(t, tc.nick, tc.twtxt)
+			verifier := twt.NewFollowerVerifier(testhelper.DummyLogger{}, testhelper.NewMockDB(), testhelper.SyncEnqueueTask, twt.NewHTTPClient(time.Second), "twtd/test", feedURL)
+
+			verified, err := verifier.Verify(context.Background(), follower)
+
+			require.NoError(t, err)
+			require.Equal(t, tc.verified, verified)
+		})
+	}
+
+	t.Run("records the verification of every follower", func(t *testing.T) {
+		alice := newFollower(t, "alice", "# follow = "+feedURL+"\n")
+		mallory := newFollower(t, "mallory", "# nick = alice\n")
+		db, err := twt.NewFileDB(t.TempDir())
+		require.NoError(t, err)
+		_ = db.LogFollower(fmt.Sprintf("twtxt/1.2.3 (+%s; @alice)", alice.URL))
+		_ = db.LogFollower(fmt.Sprintf("twtxt/1.2.3 (+%s; @mallory)", mallory.URL))
+		verifier := twt.NewFollowerVerifier(testhelper.DummyLogger{}, db, testhelper.SyncEnqueueTask, twt.NewHTTPClient(time.Second), "twtd/test", feedURL)
+
+		verifier.VerifyAll(context.Background())
+
+		followers, _ := db.ListFollowers()
+		require.Equal(t, twt.Verified, followers[0].Verification)
+		require.NotNil(t, followers[0].VerifiedAt)
+		require.Equal(t, twt.Unverified, followers[1].Verification)
+	})
+
+	t.Run("logs errors and keeps the status of unreachable followers", func(t *testing.T) {
+		remote := testhelper.NewServer(t, http.NotFoundHandler())
+		logger := testhelper.NewMockLogger()
+		db := testhelper.NewMockDB()
+		db.FollowerRecords = []twt.FollowerRecord{{Kind: "follower", Nick: "alice", URL: remote + "/twtxt.txt"}}
+		verifier := twt.NewFollowerVerifier(logger, db, testhelper.SyncEnqueueTask, twt.NewHTTPClient(time.Second), "twtd/test", feedURL)
+
+		verifier.VerifyAll(context.Background())
+
+		require.Len(t, logger.VerifyingFollowerErrs, 1)
+		require.Empty(t, db.Verifications)
+	})
+
+	t.Run("logs errors enqueuing verifications", func(t *testing.T) {
+		logger := testhelper.NewMockLogger()
+		db := testhelper.NewMockDB()
+		db.FollowerRecords = []twt.FollowerRecord{
+			{Kind: "follower", Nick: "alice", URL: "https://a.example.com/twtxt.txt"},
+			{Kind: "follower", Nick: "bob", URL: "https://b.example.com/twtxt.txt"},
+		}
+		verifier := twt.NewFollowerVerifier(logger, db, testhelper.StubEnqueueTask(task.EnqueuingTimeoutErr), twt.NewHTTPClient(time.Second), "twtd/test", feedURL)
+
+		verifier.VerifyAll(context.Background())
+
+		require.Equal(t, []error{task.EnqueuingTimeoutErr}, logger.VerifyingFollowerErrs)
+	})
+}
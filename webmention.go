@@ -0,0 +1,259 @@
+package twt
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/m25n/twt/task"
+	"github.com/m25n/twt/twtxt"
+	"html"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Webmention is a verified notification that Source links to our feed.
+type Webmention struct {
+	Source     string    `json:"source"`
+	Target     string    `json:"target"`
+	ReceivedAt time.Time `json:"received_at"`
+	VerifiedAt time.Time `json:"verified_at"`
+}
+
+func (m Webmention) key() string {
+	return m.Source + " " + m.Target
+}
+
+func postWebmentionHandler(logger Logger, db DB, enqueueTask task.EnqueueFunc, cfg *config) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		source, target := req.PostFormValue("source"), req.PostFormValue("target")
+		if _, ok := parseFollowerURL(source); !ok {
+			http.Error(res, "invalid source", http.StatusBadRequest)
+			return
+		}
+		if _, ok := parseFollowerURL(target); !ok {
+			http.Error(res, "invalid target", http.StatusBadRequest)
+			return
+		}
+		if source == target {
+			http.Error(res, "source and target must differ", http.StatusBadRequest)
+			return
+		}
+		feed, err := getFeed(db)
+		if err != nil {
+			logger.GettingTwtxtErr(err)
+			res.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if target != feedURL(feed, cfg.feedURL) {
+			http.Error(res, "target is not our feed", http.StatusBadRequest)
+			return
+		}
+		mention := Webmention{Source: source, Target: target, ReceivedAt: cfg.now()}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		err = enqueueTask(ctx, func(ctx context.Context) {
+			if err := recordWebmention(ctx, db, cfg, mention); err != nil {
+				logger.VerifyingWebmentionErr(err)
+			}
+		})
+		if err != nil {
+			logger.VerifyingWebmentionErr(err)
+			res.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		res.WriteHeader(http.StatusAccepted)
+	}
+}
+
+func recordWebmention(ctx context.Context, db DB, cfg *config, mention Webmention) error {
+	_, body, err := fetch(ctx, cfg.client, cfg.userAgent, mention.Source, http.Header{
+		"Accept": {"text/html, text/plain;q=0.9"},
+	})
+	var statusErr *UnexpectedStatusErr
+	switch {
+	case errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusGone:
+		return db.DeleteWebmention(mention.Source, mention.Target)
+	case err != nil:
+		return err
+	case !bytes.Contains(body, []byte(mention.Target)):
+		return db.DeleteWebmention(mention.Source, mention.Target)
+	}
+	mention.VerifiedAt = cfg.now()
+	return db.PutWebmention(mention)
+}
+
+func webmentionLink(cfg *config) string {
+	endpoint := siteURL(cfg.feedURL, "webmention")
+	if endpoint == "" {
+		endpoint = "webmention"
+	}
+	return fmt.Sprintf(`<%s>; rel="webmention"`, endpoint)
+}
+
+func getWebmentionsHandler(logger Logger, db DB) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		mentions, err := db.ListWebmentions()
+		if err != nil {
+			logger.GettingTwtxtErr(err)
+			res.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if mentions == nil {
+			mentions = []Webmention{}
+		}
+		sort.SliceStable(mentions, func(i, j int) bool {
+			return mentions[i].VerifiedAt.After(mentions[j].VerifiedAt)
+		})
+		writeJSON(logger, res, http.StatusOK, mentions)
+	}
+}
+
+func webmentionNotifier(logger Logger, db DB, enqueueTask task.EnqueueFunc, cfg *config) func(status []byte) {
+	return func(status []byte) {
+		posted, err := twtxt.ParseLenient(bytes.NewReader(status))
+		if err != nil || len(mentionedURLs(posted.Twts, "")) == 0 {
+			return
+		}
+		feed, err := getFeed(db)
+		if err != nil {
+			logger.GettingTwtxtErr(err)
+			return
+		}
+		source := feedURL(feed, cfg.feedURL)
+		if source == "" {
+			return
+		}
+		var sends []task.Task
+		for _, target := range mentionedURLs(posted.Twts, source) {
+			target := target
+			sends = append(sends, func(ctx context.Context) {
+				if err := SendWebmention(ctx, cfg.client, cfg.userAgent, source, target); err != nil {
+					logger.SendingWebmentionErr(err)
+				}
+			})
+		}
+		enqueueInBackground(enqueueTask, logger.SendingWebmentionErr, sends...)
+	}
+}
+
+func mentionedURLs(twts []twtxt.Twt, ours string) []string {
+	seen := map[string]bool{ours: true}
+	var urls []string
+	for _, t := range twts {
+		for _, m := range t.Mentions {
+			if !seen[m.URL] {
+				seen[m.URL] = true
+				urls = append(urls, m.URL)
+			}
+		}
+	}
+	return urls
+}
+
+// SendWebmention notifies target that source links to it, if target has a
+// webmention endpoint.
+func SendWebmention(ctx context.Context, client *http.Client, userAgent string, source string, target string) error {
+	endpoint, err := discoverWebmentionEndpoint(ctx, client, userAgent, target)
+	if err != nil || endpoint == "" {
+		return err
+	}
+	form := url.Values{"source": {source}, "target": {target}}
+	return post(ctx, client, userAgent, endpoint, "application/x-www-form-urlencoded", []byte(form.Encode()), nil)
+}
+
+func discoverWebmentionEndpoint(ctx context.Context, client *http.Client, userAgent string, target string) (string, error) {
+	res, body, err := fetch(ctx, client, userAgent, target, http.Header{
+		"Accept": {"text/html, text/plain;q=0.9"},
+	})
+	if err != nil {
+		return "", err
+	}
+	endpoint, ok := linkHeaderRel(res.Header.Values("Link"), "webmention")
+	if mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type")); !ok && mediaType == "text/html" {
+		endpoint, ok = htmlLinkRel(body, "webmention")
+	}
+	if !ok {
+		return "", nil
+	}
+	u, err := res.Request.URL.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+func linkHeaderRel(values []string, rel string) (string, bool) {
+	for _, value := range values {
+		for {
+			start := strings.IndexByte(value, '<')
+			end := strings.IndexByte(value, '>')
+			if start < 0 || end < start {
+				break
+			}
+			target := value[start+1 : end]
+			value = value[end+1:]
+			params := value
+			if next := strings.IndexByte(value, '<'); next >= 0 {
+				params = value[:next]
+			}
+			if linkParamsHaveRel(params, rel) {
+				return target, true
+			}
+		}
+	}
+	return "", false
+}
+
+func linkParamsHaveRel(params string, rel string) bool {
+	for _, param := range strings.Split(params, ";") {
+		k, v, ok := strings.Cut(param, "=")
+		if !ok || !strings.EqualFold(strings.TrimSpace(k), "rel") {
+			continue
+		}
+		v = strings.Trim(strings.TrimRight(strings.TrimSpace(v), ", "), `"`)
+		if hasRel(v, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasRel(rels string, rel string) bool {
+	for _, r := range strings.Fields(rels) {
+		if strings.EqualFold(r, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	htmlLinkRegex = regexp.MustCompile(`(?is)<(?:link|a)\s[^>]*>`)
+	htmlAttrRegex = regexp.MustCompile(`(?is)([a-z-]+)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+)
+
+func htmlLinkRel(doc []byte, rel string) (string, bool) {
+	for _, element := range htmlLinkRegex.FindAll(doc, -1) {
+		var href, rels string
+		var hasHref bool
+		for _, attr := range htmlAttrRegex.FindAllSubmatch(element, -1) {
+			value := html.UnescapeString(string(attr[2]) + string(attr[3]) + string(attr[4]))
+			switch strings.ToLower(string(attr[1])) {
+			case "href":
+				href, hasHref = value, true
+			case "rel":
+				rels = value
+			}
+		}
+		if hasHref && hasRel(rels, rel) {
+			return href, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,66 @@
+package twt_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/m25n/twt"
+	"github.com/m25n/twt/testhelper"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestSendWebmention(t *testing.T) {
+	const source = "https://example.com/twtxt.txt"
+	newTarget := func(t *testing.T, discovery func(res http.ResponseWriter, endpoint string)) (string, *[]url.Values) {
+		var received []url.Values
+		mux := http.NewServeMux()
+		mux.HandleFunc("/twtxt.txt", func(res http.ResponseWriter, req *http.Request) {
+			discovery(res, "/webmention")
+		})
+		mux.HandleFunc("/webmention", func(res http.ResponseWriter, req *http.Request) {
+			_ = req.ParseForm()
+			received = append(received, req.PostForm)
+			res.WriteHeader(http.StatusAccepted)
+		})
+		remote := testhelper.NewServer(t, mux)
+		return remote + "/twtxt.txt", &received
+	}
+
+	for name, discovery := range map[string]func(res http.ResponseWriter, endpoint string){
+		"link header": func(res http.ResponseWriter, endpoint string) {
+			res.Header().Add("Link", `<https://example.com/hub>; rel="hub", <`+endpoint+`>; rel="webmention"`)
+			_, _ = fmt.Fprint(res, "2022-01-01T00:00:00Z\tHello\n")
+		},
+		"html link element": func(res http.ResponseWriter, endpoint string) {
+			res.Header().Set("Content-Type", "text/html; charset=utf-8")
+			_, _ = fmt.Fprintf(res, `<html><head><link rel="stylesheet" href="/style.css"><link href="%s" rel="webmention"></head></html>`, endpoint)
+		},
+		"html a element": func(res http.ResponseWriter, endpoint string) {
+			res.Header().Set("Content-Type", "text/html")
+			_, _ = fmt.Fprintf(res, `<a rel='me webmention' href='%s'>webmention</a>`, endpoint)
+		},
+	} {
+		t.Run("discovers the endpoint through "+name, func(t *testing.T) {
+			target, received := newTarget(t, discovery)
+
+			err := twt.SendWebmention(context.Background(), twt.NewHTTPClient(time.Second), "twtd/test", source, target)
+
+			require.NoError(t, err)
+			require.Equal(t, []url.Values{{"source": {source}, "target": {target}}}, *received)
+		})
+	}
+
+	t.Run("skips targets without an endpoint", func(t *testing.T) {
+		target, received := newTarget(t, func(res http.ResponseWriter, _ string) {
+			_, _ = fmt.Fprint(res, "2022-01-01T00:00:00Z\tHello\n")
+		})
+
+		err := twt.SendWebmention(context.Background(), twt.NewHTTPClient(time.Second), "twtd/test", source, target)
+
+		require.NoError(t, err)
+		require.Empty(t, *received)
+	})
+}
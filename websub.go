@@ -0,0 +1,208 @@
+package twt
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/m25n/twt/task"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Subscription is a verified WebSub subscriber of our feed.
+type Subscription struct {
+	Callback string    `json:"callback"`
+	Topic    string    `json:"topic"`
+	Secret   string    `json:"secret,omitempty"`
+	Expires  time.Time `json:"expires"`
+}
+
+const (
+	defaultLease    = 10 * 24 * time.Hour
+	maxLease        = 30 * 24 * time.Hour
+	maxSecretLength = 200
+)
+
+var ChallengeMismatchErr = errors.New("subscriber did not echo the challenge")
+
+func hubURL(cfg *config) string {
+	if cfg.hubURL != "" {
+		return cfg.hubURL
+	}
+	return siteURL(cfg.feedURL, "hub")
+}
+
+func postHubHandler(logger Logger, db DB, enqueueTask task.EnqueueFunc, cfg *config) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		if cfg.hubURL != "" {
+			http.NotFound(res, req)
+			return
+		}
+		mode := req.PostFormValue("hub.mode")
+		if mode != "subscribe" && mode != "unsubscribe" {
+			http.Error(res, "unsupported hub.mode", http.StatusBadRequest)
+			return
+		}
+		callback, ok := parseFollowerURL(req.PostFormValue("hub.callback"))
+		if !ok {
+			http.Error(res, "invalid hub.callback", http.StatusBadRequest)
+			return
+		}
+		if cfg.feedURL == "" || req.PostFormValue("hub.topic") != cfg.feedURL {
+			http.Error(res, "hub.topic is not our feed", http.StatusBadRequest)
+			return
+		}
+		secret := req.PostFormValue("hub.secret")
+		if len(secret) >= maxSecretLength {
+			http.Error(res, "hub.secret is too long", http.StatusBadRequest)
+			return
+		}
+		lease := parseLease(req.PostFormValue("hub.lease_seconds"))
+		sub := Subscription{Callback: callback.String(), Topic: cfg.feedURL, Secret: secret, Expires: cfg.now().Add(lease)}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		err := enqueueTask(ctx, func(ctx context.Context) {
+			if err := verifySubscription(ctx, db, cfg, mode, sub, lease); err != nil {
+				logger.VerifyingSubscriptionErr(err)
+			}
+		})
+		if err != nil {
+			logger.VerifyingSubscriptionErr(err)
+			res.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		res.WriteHeader(http.StatusAccepted)
+	}
+}
+
+func parseLease(seconds string) time.Duration {
+	n, err := strconv.Atoi(seconds)
+	if err != nil || n <= 0 {
+		return defaultLease
+	}
+	if lease := time.Duration(n) * time.Second; lease < maxLease {
+		return lease
+	}
+	return maxLease
+}
+
+func verifySubscription(ctx context.Context, db DB, cfg *config, mode string, sub Subscription, lease time.Duration) error {
+	challenge := make([]byte, 16)
+	if _, err := rand.Read(challenge); err != nil {
+		return err
+	}
+	callback, err := url.Parse(sub.Callback)
+	if err != nil {
+		return err
+	}
+	query := callback.Query()
+	query.Set("hub.mode", mode)
+	query.Set("hub.topic", sub.Topic)
+	query.Set("hub.challenge", hex.EncodeToString(challenge))
+	if mode == "subscribe" {
+		query.Set("hub.lease_seconds", strconv.Itoa(int(lease.Seconds())))
+	}
+	callback.RawQuery = query.Encode()
+	_, body, err := fetch(ctx, cfg.client, cfg.userAgent, callback.String(), nil)
+	if err != nil {
+		return err
+	}
+	if string(body) != hex.EncodeToString(challenge) {
+		return ChallengeMismatchErr
+	}
+	if mode == "unsubscribe" {
+		return db.DeleteSubscription(sub.Callback)
+	}
+	return db.PutSubscription(sub)
+}
+
+func websubNotifier(logger Logger, db DB, enqueueTask task.EnqueueFunc, cfg *config) func(status []byte) {
+	return func(_ []byte) {
+		if cfg.feedURL == "" {
+			return
+		}
+		if cfg.hubURL == "" {
+			enqueueInBackground(enqueueTask, logger.PublishingFeedErr, feedDeliveries(logger, db, cfg)...)
+			return
+		}
+		enqueueInBackground(enqueueTask, logger.PublishingFeedErr, func(ctx context.Context) {
+			if err := pingHub(ctx, cfg); err != nil {
+				logger.PublishingFeedErr(err)
+			}
+		})
+	}
+}
+
+func pingHub(ctx context.Context, cfg *config) error {
+	form := url.Values{"hub.mode": {"publish"}, "hub.url": {cfg.feedURL}}
+	return post(ctx, cfg.client, cfg.userAgent, cfg.hubURL, "application/x-www-form-urlencoded", []byte(form.Encode()), nil)
+}
+
+func feedDeliveries(logger Logger, db DB, cfg *config) []task.Task {
+	subs, err := db.ListSubscriptions()
+	if err != nil {
+		logger.PublishingFeedErr(err)
+		return nil
+	}
+	file, err := db.Get()
+	if err != nil {
+		logger.GettingTwtxtErr(err)
+		return nil
+	}
+	content, err := io.ReadAll(file)
+	_ = file.Close()
+	if err != nil {
+		logger.GettingTwtxtErr(err)
+		return nil
+	}
+	header := http.Header{"Link": webSubLinks(cfg)}
+	var deliveries []task.Task
+	for _, sub := range subs {
+		if !cfg.now().Before(sub.Expires) {
+			if err := db.DeleteSubscription(sub.Callback); err != nil {
+				logger.PublishingFeedErr(err)
+			}
+			continue
+		}
+		sub := sub
+		deliveries = append(deliveries, func(ctx context.Context) {
+			var statusErr *UnexpectedStatusErr
+			err := post(ctx, cfg.client, cfg.userAgent, sub.Callback, "text/vnd.twtxt+plain; charset=utf-8", content, signed(header, sub.Secret, content))
+			if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusGone {
+				err = db.DeleteSubscription(sub.Callback)
+			}
+			if err != nil {
+				logger.PublishingFeedErr(err)
+			}
+		})
+	}
+	return deliveries
+}
+
+func signed(header http.Header, secret string, content []byte) http.Header {
+	header = header.Clone()
+	if secret != "" {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(content)
+		header.Set("X-Hub-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	return header
+}
+
+func webSubLinks(cfg *config) []string {
+	hub := hubURL(cfg)
+	if hub == "" || cfg.feedURL == "" {
+		return nil
+	}
+	return []string{
+		fmt.Sprintf(`<%s>; rel="hub"`, hub),
+		fmt.Sprintf(`<%s>; rel="self"`, cfg.feedURL),
+	}
+}